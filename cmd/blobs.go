@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/service"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+)
+
+const blobsUsage = "usage: blobs migrate FROM TO [BATCH_SIZE]"
+
+// runBlobsCommand handles `<binary> blobs ...`. The migration can run next to the serving instances
+// and be interrupted at any time, running it again continues with the drawings left behind.
+func runBlobsCommand(drawings *service.DrawingService, args []string) error {
+	if len(args) < 3 || args[0] != "migrate" {
+		return errors.New(blobsUsage)
+	}
+
+	batchSize := 100
+	if len(args) > 3 {
+		var err error
+		if batchSize, err = strconv.Atoi(args[3]); err != nil || batchSize < 1 {
+			return errors.New(blobsUsage)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	moved, err := drawings.MigrateBlobs(ctx, args[1], args[2], batchSize)
+	log.Printf("moved %d drawings from %s to %s", moved, args[1], args[2])
+	return err
+}
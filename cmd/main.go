@@ -1,17 +1,30 @@
 package main
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"github.com/dankru/Commissions_simple/internal/domain"
 	"github.com/dankru/Commissions_simple/internal/grpc"
+	"github.com/dankru/Commissions_simple/internal/issuer"
 	"github.com/dankru/Commissions_simple/internal/repository/pg_repo"
 	"github.com/dankru/Commissions_simple/internal/server"
 	"github.com/dankru/Commissions_simple/internal/service"
+	grpcapi "github.com/dankru/Commissions_simple/internal/transport/grpc"
 	"github.com/dankru/Commissions_simple/internal/transport/rest"
 	"github.com/dankru/Commissions_simple/pkg/database/pg_db"
 	hash "github.com/dankru/Commissions_simple/pkg/hasher"
+	"github.com/dankru/Commissions_simple/pkg/jwks"
+	"github.com/dankru/Commissions_simple/pkg/mailer"
+	"github.com/dankru/Commissions_simple/pkg/oidc"
+	"github.com/dankru/Commissions_simple/pkg/ratelimit"
+	"github.com/dankru/Commissions_simple/pkg/storage"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
 	"log"
+	"net/http"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -30,23 +43,119 @@ func main() {
 	postgres := pg_db.NewPostgreSQLDB(conn)
 	defer postgres.Close()
 
-	hasher := hash.NewSHA1Hasher(os.Getenv("SALT"))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(postgres.DB, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %s", err.Error())
+		}
+		return
+	}
+
+	if viper.GetBool("database.migrateOnStart") {
+		if err := migrateUp(postgres.DB); err != nil {
+			log.Fatalf("failed to apply migrations: %s", err.Error())
+		}
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "blobs" {
+		if err := runBlobsCommand(newDrawingService(postgres.DB, nil), os.Args[2:]); err != nil {
+			log.Fatalf("blobs: %s", err.Error())
+		}
+		return
+	}
+
+	hasher := newPasswordHasher()
 
 	userRepo := pg_repo.NewRepository(postgres.DB)
 	authRepo := pg_repo.NewAuthRepository(postgres.DB)
 	tokensRepo := pg_repo.NewTokensRepository(postgres.DB)
+	actionTokensRepo := pg_repo.NewActionTokensRepository(postgres.DB)
+	loginAttemptsRepo := pg_repo.NewLoginAttemptsRepository(postgres.DB)
+	mfaRepo := pg_repo.NewMFARepository(postgres.DB)
+	apiKeysRepo := pg_repo.NewAPIKeysRepository(postgres.DB)
+	identitiesRepo := pg_repo.NewExternalIdentitiesRepository(postgres.DB)
+	auditRepo := pg_repo.NewAuditEventsRepository(postgres.DB)
+	reviewsRepo := pg_repo.NewReviewsRepository(postgres.DB)
+
+	var grpcClient service.GrpcClient
+	var verifier service.TokenVerifier
+	var embeddedIssuer *issuer.Issuer
+
+	switch mode := viper.GetString("authServer.mode"); mode {
+	case "embedded":
+		var err error
+		embeddedIssuer, err = issuer.New(os.Getenv("AUTH_PRIVATE_KEY_FILE"),
+			viper.GetString("authServer.embedded.issuer"),
+			viper.GetDuration("authServer.embedded.accessTokenTTL"))
+		if err != nil {
+			log.Fatalf("failed to create token issuer: %s", err.Error())
+		}
+		grpcClient = embeddedIssuer
+	case "grpc", "":
+		grpcClient = grpc.NewGrpcClient(viper.GetString("authServer.host") + viper.GetString("authServer.port"))
+		if jwksUrl := viper.GetString("authServer.jwksUrl"); jwksUrl != "" {
+			tokenIssuer := viper.GetString("authServer.jwksIssuer")
+			if tokenIssuer == "" {
+				log.Fatal("authServer.jwksIssuer is required to verify tokens with authServer.jwksUrl")
+			}
+			verifier = jwks.NewVerifier(jwksUrl, viper.GetDuration("authServer.jwksRefreshInterval"),
+				tokenIssuer, viper.GetString("authServer.jwksAudience"))
+		}
+	default:
+		log.Fatalf("unknown auth server mode: %s", mode)
+	}
+
+	auditLog := service.NewAuditLog(auditRepo)
+
+	authService := service.NewAuthService(authRepo, tokensRepo, actionTokensRepo, loginAttemptsRepo, mfaRepo, identitiesRepo, newOIDCProviders(),
+		hasher, grpcClient, verifier, newMailer(), auditLog,
+		service.AuthConfig{
+			RefreshTokenTTL:          viper.GetDuration("auth.refreshTokenTTL"),
+			RequireEmailVerification: viper.GetBool("auth.requireEmailVerification"),
+			EmailVerificationTTL:     viper.GetDuration("auth.emailVerificationTTL"),
+			VerifyEmailURL:           viper.GetString("auth.verifyEmailUrl"),
+			PasswordResetTTL:         viper.GetDuration("auth.passwordResetTTL"),
+			ResetPasswordURL:         viper.GetString("auth.resetPasswordUrl"),
+			Lockout: service.LockoutPolicy{
+				AccountThreshold: viper.GetInt("auth.lockout.accountThreshold"),
+				IPThreshold:      viper.GetInt("auth.lockout.ipThreshold"),
+				BaseDelay:        viper.GetDuration("auth.lockout.baseDelay"),
+				MaxDelay:         viper.GetDuration("auth.lockout.maxDelay"),
+				Window:           viper.GetDuration("auth.lockout.window"),
+			},
+			MFAIssuer:       viper.GetString("auth.mfa.issuer"),
+			MFAChallengeTTL: viper.GetDuration("auth.mfa.challengeTTL"),
+			OIDCStateTTL:    viper.GetDuration("auth.oidc.stateTTL"),
+		})
+
+	userService := service.NewService(userRepo, hasher, auditLog, authService)
+	apiKeyService := service.NewAPIKeyService(apiKeysRepo)
+	reviewService := service.NewReviewService(reviewsRepo, userRepo)
 
-	grpcClient := grpc.NewGrpcClient(viper.GetString("authServer.host") + viper.GetString("authServer.port"))
+	drawingService := newDrawingService(postgres.DB, newShareSecret())
+	tagService := service.NewTagService(pg_repo.NewTagsRepository(postgres.DB))
 
-	userService := service.NewService(userRepo)
-	authService := service.NewAuthService(authRepo, tokensRepo, hasher, grpcClient)
+	handler := rest.NewHandler(authService, userService, apiKeyService, reviewService, drawingService, tagService, auditLog, newCookiePolicy(),
+		newTrustedProxies(), newRateLimiter())
+	router := handler.InitRouter()
+	if embeddedIssuer != nil {
+		router.Handle("/.well-known/jwks.json", embeddedIssuer.JWKSHandler()).Methods(http.MethodGet)
+	}
+
+	if addr := viper.GetString("grpcServer.port"); addr != "" {
+		grpcToken := os.Getenv("GRPC_SERVER_TOKEN")
+		if grpcToken == "" {
+			log.Fatalf("GRPC_SERVER_TOKEN is required when grpcServer.port is set")
+		}
+		grpcHandler := grpcapi.NewHandler(userService, authService, apiKeyService)
+		grpcSrv := server.NewGRPCServer(addr, grpcapi.NewServer(grpcHandler, grpcToken))
+		go grpcSrv.Run()
+	}
 
-	handler := rest.NewHandler(authService, userService)
 	srv := server.NewServer(viper.GetString("server.port"),
 		viper.GetDuration("server.writeTimeout"),
 		viper.GetDuration("server.readTimeout"),
 		viper.GetDuration("server.idleTimeout"),
-		handler.InitRouter())
+		router)
 
 	srv.Run()
 }
@@ -54,5 +163,199 @@ func main() {
 func initConfig() error {
 	viper.AddConfigPath("../configs")
 	viper.SetConfigName("config")
+	// any key can be overridden from the environment, e.g. AUTHSERVER_MODE=embedded
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 	return viper.ReadInConfig()
 }
+
+// newPasswordHasher hashes with the configured algorithm and still accepts bcrypt and legacy
+// SHA1 hashes, which are upgraded on the next successful sign-in.
+func newPasswordHasher() *hash.PasswordHasher {
+	argon2id := hash.NewArgon2idHasher(hash.Argon2idParams{
+		Memory:      viper.GetUint32("hasher.argon2id.memory"),
+		Iterations:  viper.GetUint32("hasher.argon2id.iterations"),
+		Parallelism: uint8(viper.GetUint("hasher.argon2id.parallelism")),
+		SaltLength:  hash.DefaultArgon2idParams.SaltLength,
+		KeyLength:   hash.DefaultArgon2idParams.KeyLength,
+	})
+	bcrypt := hash.NewBcryptHasher(viper.GetInt("hasher.bcrypt.cost"))
+	sha1 := hash.NewSHA1Hasher(os.Getenv("SALT"))
+
+	switch algorithm := viper.GetString("hasher.algorithm"); algorithm {
+	case "bcrypt":
+		return hash.NewPasswordHasher(bcrypt, argon2id, sha1)
+	case "argon2id", "":
+		return hash.NewPasswordHasher(argon2id, bcrypt, sha1)
+	default:
+		log.Fatalf("unknown password hashing algorithm: %s", algorithm)
+		return nil
+	}
+}
+
+func newMailer() service.Mailer {
+	from := viper.GetString("mail.from")
+
+	switch driver := viper.GetString("mail.driver"); driver {
+	case "smtp":
+		return mailer.NewSMTPMailer(viper.GetString("mail.smtp.host"), viper.GetString("mail.smtp.port"),
+			os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "file":
+		fileMailer, err := mailer.NewFileMailer(viper.GetString("mail.file.dir"), from)
+		if err != nil {
+			log.Fatalf("failed to create file mailer: %s", err.Error())
+		}
+		return fileMailer
+	case "log", "":
+		return mailer.NewLogMailer()
+	default:
+		log.Fatalf("unknown mail driver: %s", driver)
+		return nil
+	}
+}
+
+// newDrawingService opens the blob stores of the configured storage providers. Local storage is always
+// available, S3 when drawings.storage.s3.endpoint is set; its keys are read from S3_ACCESS_KEY and S3_SECRET_KEY.
+// Commands that don't serve share links pass a nil shareSecret.
+func newDrawingService(db *sql.DB, shareSecret []byte) *service.DrawingService {
+	stores := make(map[string]service.BlobStore)
+
+	local, err := storage.NewLocal(viper.GetString("drawings.storage.local.dir"))
+	if err != nil {
+		log.Fatalf("failed to open local drawings storage: %s", err.Error())
+	}
+	stores[domain.StorageLocal] = local
+
+	if endpoint := viper.GetString("drawings.storage.s3.endpoint"); endpoint != "" {
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  endpoint,
+			Region:    viper.GetString("drawings.storage.s3.region"),
+			Bucket:    viper.GetString("drawings.storage.s3.bucket"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: viper.GetBool("drawings.storage.s3.pathStyle"),
+		})
+		if err != nil {
+			log.Fatalf("failed to configure S3 drawings storage: %s", err.Error())
+		}
+		stores[domain.StorageS3] = s3
+	}
+
+	provider := viper.GetString("drawings.storage.provider")
+	if _, ok := stores[provider]; !ok {
+		log.Fatalf("drawings storage provider %q is not configured", provider)
+	}
+
+	return service.NewDrawingService(pg_repo.NewDrawingsRepository(db), stores, provider,
+		int64(viper.GetSizeInBytes("drawings.maxFileSize")), viper.GetDuration("drawings.storage.presignTTL"), shareSecret)
+}
+
+// newShareSecret reads the DRAWING_SHARE_SECRET share links are signed with, only server.devMode makes do with an ephemeral one.
+func newShareSecret() []byte {
+	shareSecret := []byte(os.Getenv("DRAWING_SHARE_SECRET"))
+	switch {
+	case len(shareSecret) == 0 && viper.GetBool("server.devMode"):
+		log.Println("DRAWING_SHARE_SECRET is not set, generating an ephemeral one: share links won't survive a restart")
+		shareSecret = make([]byte, 32)
+		if _, err := rand.Read(shareSecret); err != nil {
+			log.Fatalf("failed to generate the share secret: %s", err.Error())
+		}
+	case len(shareSecret) == 0:
+		log.Fatalf("DRAWING_SHARE_SECRET is required, every replica must sign share links with the same secret")
+	case len(shareSecret) < 32:
+		log.Fatalf("DRAWING_SHARE_SECRET must be at least 32 bytes long")
+	}
+
+	return shareSecret
+}
+
+// newOIDCProviders reads auth.oidc.providers. Client secrets are best passed in the environment,
+// e.g. AUTH_OIDC_PROVIDERS_GOOGLE_CLIENTSECRET.
+func newOIDCProviders() map[string]service.OIDCProvider {
+	providers := make(map[string]service.OIDCProvider)
+
+	for name := range viper.GetStringMap("auth.oidc.providers") {
+		key := "auth.oidc.providers." + name
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Issuer:       viper.GetString(key + ".issuer"),
+			ClientID:     viper.GetString(key + ".clientId"),
+			ClientSecret: viper.GetString(key + ".clientSecret"),
+			RedirectURL:  viper.GetString(key + ".redirectUrl"),
+			Scopes:       viper.GetStringSlice(key + ".scopes"),
+		})
+	}
+
+	return providers
+}
+
+func newCookiePolicy() rest.CookiePolicy {
+	sameSite, err := rest.ParseSameSite(viper.GetString("auth.cookie.sameSite"))
+	if err != nil {
+		log.Fatalf("invalid cookie policy: %s", err.Error())
+	}
+
+	return rest.CookiePolicy{
+		Domain:   viper.GetString("auth.cookie.domain"),
+		Path:     viper.GetString("auth.cookie.path"),
+		Secure:   viper.GetBool("auth.cookie.secure"),
+		SameSite: sameSite,
+		MaxAge:   viper.GetDuration("auth.refreshTokenTTL"),
+	}
+}
+
+func newTrustedProxies() rest.TrustedProxies {
+	proxies, err := rest.ParseTrustedProxies(viper.GetStringSlice("server.trustedProxies"))
+	if err != nil {
+		log.Fatalf("invalid server.trustedProxies: %s", err.Error())
+	}
+	return proxies
+}
+
+// newRateLimiter returns nil when rate limiting is disabled. Policies are read from rateLimit.policies,
+// the "default" one applies to route groups without their own.
+func newRateLimiter() rest.RateLimiter {
+	if !viper.GetBool("rateLimit.enabled") {
+		return nil
+	}
+
+	readLimit := func(key string) ratelimit.Limit {
+		limit := ratelimit.Limit{
+			Requests: viper.GetInt(key + ".requests"),
+			Per:      viper.GetDuration(key + ".per"),
+			Burst:    viper.GetInt(key + ".burst"),
+		}
+		if limit.Requests <= 0 || limit.Per <= 0 {
+			log.Fatalf("invalid rate limit %s", key)
+		}
+		if limit.Burst <= 0 {
+			limit.Burst = limit.Requests
+		}
+		return limit
+	}
+
+	policies := make(map[string]ratelimit.Limit)
+	for name := range viper.GetStringMap("rateLimit.policies") {
+		policies[name] = readLimit("rateLimit.policies." + name)
+	}
+
+	fallback, ok := policies["default"]
+	if !ok {
+		log.Fatalf("rate limit policy \"default\" is required")
+	}
+
+	var store ratelimit.Store
+	switch driver := viper.GetString("rateLimit.store"); driver {
+	case "redis":
+		store = ratelimit.NewRedisStore(redis.NewClient(&redis.Options{
+			Addr:     viper.GetString("rateLimit.redis.addr"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       viper.GetInt("rateLimit.redis.db"),
+		}), "ratelimit:")
+	case "memory", "":
+		store = ratelimit.NewMemoryStore()
+	default:
+		log.Fatalf("unknown rate limit store: %s", driver)
+	}
+
+	return ratelimit.NewLimiter(store, policies, fallback)
+}
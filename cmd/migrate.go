@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/pkg/database/migrate"
+	"github.com/dankru/Commissions_simple/schema"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [N] | status | force VERSION"
+
+// runMigrateCommand handles `<binary> migrate ...`.
+func runMigrateCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := migrate.New(db, schema.Migrations)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return applyMigrations(ctx, migrator)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, version, dirty, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current version: %d (dirty: %t)\n", version, dirty)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%06d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	case "force":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New(migrateUsage)
+		}
+		return migrator.Force(ctx, version)
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func migrateUp(db *sql.DB) error {
+	migrator, err := migrate.New(db, schema.Migrations)
+	if err != nil {
+		return err
+	}
+
+	return applyMigrations(context.Background(), migrator)
+}
+
+// applyMigrations applies the pending migrations, it's fine when there are none.
+func applyMigrations(ctx context.Context, migrator *migrate.Migrator) error {
+	if err := migrator.Up(ctx); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+)
+
+// ActionToken is a single-use token that lets its holder perform one action on behalf of the user.
+type ActionToken struct {
+	TokenHash string
+	UserID    string
+	Purpose   string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidAPIKey     = errors.New("Invalid API key")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrInsufficientScope = errors.New("API key lacks the required scope")
+	ErrAPIKeyPrefixTaken = errors.New("API key prefix is already taken")
+)
+
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// APIKeyPrefix starts every API key, so keys are easy to tell apart from JWTs and to spot in leaks.
+const APIKeyPrefix = "uk_"
+
+// APIKey lets tools act on behalf of a user within its scopes. Only the hash of the secret is stored.
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKeyInput struct {
+	Name      string     `json:"name" validate:"required,lte=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=users:read users:write"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty"`
+}
+
+func (i APIKeyInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+	if i.ExpiresAt != nil && i.ExpiresAt.Before(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
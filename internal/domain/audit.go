@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+const (
+	AuditSignUp                 = "user.sign_up"
+	AuditSignIn                 = "auth.sign_in"
+	AuditSignInMFA              = "auth.sign_in_mfa"
+	AuditOIDCSignIn             = "auth.oidc_sign_in"
+	AuditIdentityLinked         = "auth.identity_linked"
+	AuditRefresh                = "auth.refresh"
+	AuditLogout                 = "auth.logout"
+	AuditLogoutAll              = "auth.logout_all"
+	AuditSessionRevoked         = "auth.session_revoked"
+	AuditEmailVerified          = "user.email_verified"
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditPasswordReset          = "user.password_reset"
+	AuditPasswordChanged        = "user.password_changed"
+	AuditEmailChanged           = "user.email_changed"
+	AuditRoleChanged            = "user.role_changed"
+	AuditUserUpdated            = "user.updated"
+	AuditUserDeleted            = "user.deleted"
+	AuditAccountUnlocked        = "user.unlocked"
+	AuditMFAEnabled             = "mfa.enabled"
+	AuditMFADisabled            = "mfa.disabled"
+	AuditMFAReset               = "mfa.reset"
+	AuditRecoveryCodesRenewed   = "mfa.recovery_codes_regenerated"
+)
+
+// AuditEvent records who did what to which account. ActorID is empty for anonymous requests
+// and TargetID when the account is unknown, e.g. a sign-in with an unregistered email.
+type AuditEvent struct {
+	ID        int64
+	ActorID   string
+	TargetID  string
+	Action    string
+	IP        string
+	UserAgent string
+	Outcome   string
+	Metadata  map[string]any
+	CreatedAt time.Time
+}
+
+// AuditFilter selects events newest first. UserID matches both the actor and the target.
+// Before is the id of the last event of the previous page.
+type AuditFilter struct {
+	UserID string
+	Action string
+	From   *time.Time
+	To     *time.Time
+	Before int64
+	Limit  int
+}
+
+type auditCtxKey int
+
+const (
+	ctxAuditActor auditCtxKey = iota
+	ctxAuditClient
+)
+
+// WithActor remembers the authenticated user making the request, so audit events can name them.
+func WithActor(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, ctxAuditActor, userId)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxAuditActor).(string)
+	return id
+}
+
+func WithClientInfo(ctx context.Context, client ClientInfo) context.Context {
+	return context.WithValue(ctx, ctxAuditClient, client)
+}
+
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	client, _ := ctx.Value(ctxAuditClient).(ClientInfo)
+	return client
+}
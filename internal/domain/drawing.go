@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDrawingNotFound      = errors.New("Drawing not found")
+	ErrUnsupportedMediaType = errors.New("Only PNG, JPEG, GIF and WebP images can be uploaded")
+	ErrFileTooLarge         = errors.New("File is too large")
+	ErrDrawingNotShareable  = errors.New("Only drawings with link visibility can be shared")
+)
+
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+	VisibilityLink    = "link"
+)
+
+// Storage providers of the drawings.storage_provider column.
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+	StorageOther = "other"
+)
+
+type Drawing struct {
+	ID          string
+	ArtistID    string
+	Title       string
+	Description *string
+	// FilePath is the key of the file at the storage provider
+	FilePath        string
+	StorageProvider string
+	Visibility      string
+	ContentType     string
+	Size            int64
+	Tags            []string
+	// ShareVersion signs the share links, it is bumped to invalidate them
+	ShareVersion int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// DrawingInput holds the form fields sent with an upload.
+type DrawingInput struct {
+	Title       string  `validate:"required,lte=200"`
+	Description *string `validate:"omitempty,lte=5000"`
+	Visibility  string  `validate:"omitempty,oneof=private public link"`
+}
+
+func (i DrawingInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type DrawingUpdateInput struct {
+	Title       *string `json:"title" validate:"omitempty,gte=1,lte=200"`
+	Description *string `json:"description" validate:"omitempty,lte=5000"`
+	Visibility  *string `json:"visibility" validate:"omitempty,oneof=private public link"`
+}
+
+func (i DrawingUpdateInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// DrawingFilter selects public drawings, and all drawings of PublicOrOwnedBy when it is set.
+// Drawings shared by link are never listed for anyone but their artist.
+type DrawingFilter struct {
+	PublicOrOwnedBy string
+	ArtistID        string
+	// Tags are normalized tag names or aliases. Drawings need all of them with MatchAllTags, otherwise any
+	Tags         []string
+	MatchAllTags bool
+	Limit        int
+	Offset       int
+}
+
+type ShareLinkInput struct {
+	// ExpiresAt is optional, links without it are valid until the share links are rotated
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (i ShareLinkInput) Validate() error {
+	if i.ExpiresAt != nil && i.ExpiresAt.Before(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
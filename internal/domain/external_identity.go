@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownProvider      = errors.New("Unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("Invalid or expired login state")
+	ErrProviderEmailMissing = errors.New("Identity provider didn't share a verified email")
+	// ErrIdentityLinkNotAllowed protects accounts registered with somebody else's unverified email from being taken over
+	ErrIdentityLinkNotAllowed = errors.New("An account with this email exists but its email is not verified, sign in with the password first")
+	ErrUsernameTaken          = errors.New("Username is taken")
+)
+
+// ExternalIdentity is an account at an OpenID Connect provider that can be used to sign in as the user.
+type ExternalIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// OIDCState is a login started at a provider, kept until the provider redirects back.
+type OIDCState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("Invalid two-factor code")
+	ErrMFAAlreadyEnabled   = errors.New("Two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("Two-factor authentication is not enabled")
+	ErrMFAEnrollmentNeeded = errors.New("Two-factor enrollment has not been started")
+)
+
+const PurposeMFAChallenge = "mfa_challenge"
+
+type TOTP struct {
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+// SignInResult holds either the tokens or, when the second factor is still required,
+// a short-lived MFAToken to present along with the code. SessionID is the refresh token family.
+type SignInResult struct {
+	AccessToken  string
+	RefreshToken string
+	SessionID    string
+	MFAToken     string
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type MFASignInInput struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func (i MFASignInInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i MFACodeInput) Validate() error {
+	return validate.Struct(i)
+}
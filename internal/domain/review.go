@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrReviewNotFound  = errors.New("Review not found")
+	ErrSelfReview      = errors.New("Users can't review themselves")
+	ErrDuplicateReview = errors.New("The user is already reviewed, edit the existing review instead")
+)
+
+type Review struct {
+	ID         int64
+	ReviewerID string
+	RevieweeID string
+	Rating     int
+	Comment    *string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type ReviewInput struct {
+	Rating  int     `json:"rating" validate:"required,min=1,max=5"`
+	Comment *string `json:"comment" validate:"omitempty,lte=2000"`
+}
+
+func (i ReviewInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// RatingSummary aggregates the reviews of a user. Histogram holds the number of reviews per rating, 1 to 5.
+type RatingSummary struct {
+	Average   float64
+	Count     int
+	Histogram map[int]int
+}
+
+// NewRatingSummary aggregates the numbers of reviews per rating.
+func NewRatingSummary(counts map[int]int) RatingSummary {
+	summary := RatingSummary{Histogram: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	sum := 0
+	for rating, count := range counts {
+		summary.Histogram[rating] = count
+		summary.Count += count
+		sum += rating * count
+	}
+
+	if summary.Count > 0 {
+		summary.Average = float64(sum) / float64(summary.Count)
+	}
+
+	return summary
+}
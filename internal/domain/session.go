@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("Session not found")
+
+// ClientInfo describes where a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// Session is one sign-in, i.e. one refresh token family. IP and UserAgent are taken from the latest refresh.
+type Session struct {
+	ID         string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	Current    bool
+}
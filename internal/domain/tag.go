@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTagNotFound   = errors.New("Tag not found")
+	ErrTagExists     = errors.New("A tag or an alias with this name already exists")
+	ErrInvalidTag    = errors.New("Tags must be 1 to 50 characters long")
+	ErrTooManyTags   = errors.New("A drawing can have at most 20 tags")
+	ErrMergeSameTags = errors.New("A tag can't be merged into itself")
+)
+
+const (
+	MaxTagLength      = 50
+	MaxTagsPerDrawing = 20
+)
+
+type Tag struct {
+	ID      int64
+	Name    string
+	Aliases []string
+	// Uses is the number of public drawings with the tag
+	Uses int
+}
+
+// NormalizeTag lowercases the name and collapses its whitespace, so "Digital  Art" and "digital art" are one tag.
+func NormalizeTag(name string) (string, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if normalized == "" || utf8.RuneCountInString(normalized) > MaxTagLength {
+		return "", ErrInvalidTag
+	}
+	return normalized, nil
+}
+
+// NormalizeTags normalizes the names and drops the duplicates.
+func NormalizeTags(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+type TagsInput struct {
+	Tags []string `json:"tags" validate:"required,min=1,max=20"`
+}
+
+func (i TagsInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type TagNameInput struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func (i TagNameInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type TagMergeInput struct {
+	// Into is the id of the tag that is kept
+	Into int64 `json:"into" validate:"required,gt=0"`
+}
+
+func (i TagMergeInput) Validate() error {
+	return validate.Struct(i)
+}
@@ -1,10 +1,26 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
+var (
+	ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("Refresh token is expired")
+	ErrRefreshTokenReused  = errors.New("Refresh token has already been used")
+)
+
+// RefreshSession is a single refresh token. Tokens issued by rotating one another share a FamilyID,
+// which represents one sign-in.
 type RefreshSession struct {
 	ID        int64
-	UserID    int64
-	Token     string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	Client    ClientInfo
 	ExpiresAt time.Time
+	CreatedAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
 }
@@ -3,10 +3,33 @@ package domain
 import (
 	"errors"
 	"github.com/go-playground/validator/v10"
+	"regexp"
 	"time"
 )
 
-var ErrUserNotFound = errors.New("User not found")
+var (
+	ErrUserNotFound       = errors.New("User not found")
+	ErrInvalidCredentials = errors.New("Invalid email or password")
+	ErrForbidden          = errors.New("Forbidden")
+	ErrEmailNotVerified   = errors.New("Email is not verified")
+)
+
+const (
+	RoleBuyer  = "buyer"
+	RoleArtist = "artist"
+	RoleBoth   = "both"
+	RoleAdmin  = "admin"
+)
+
+// UUIDPattern matches the textual form of the uuid ids, e.g. users.users.user_id.
+const UUIDPattern = "[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}"
+
+var uuidRegexp = regexp.MustCompile("^" + UUIDPattern + "$")
+
+// IsUUID reports whether s can be cast to a uuid in a query.
+func IsUUID(s string) bool {
+	return uuidRegexp.MatchString(s)
+}
 
 var validate *validator.Validate
 
@@ -15,21 +38,35 @@ func init() {
 }
 
 type User struct {
-	ID           int64  `json:"id"`
-	Name         string `json:"name"`
-	Email        string `json:"email"`
-	Password     string
-	RegisteredAt time.Time
+	ID              string
+	AuthID          int64
+	Username        string
+	Email           string
+	Password        string
+	Role            string
+	AvatarURL       *string
+	Bio             *string
+	RegisteredAt    time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt *time.Time
+	TOTPEnabledAt   *time.Time
+	// FailedSignIns and LockedUntil are the account lockout state, see LockoutScopeAccount.
+	FailedSignIns int
+	LockedUntil   *time.Time
 }
 
 type Input interface {
-	UserInput | SignInInput
+	UserInput | SignInInput | TokenInput | EmailInput | ResetPasswordInput | MFASignInInput | MFACodeInput |
+		APIKeyInput | ReviewInput | DrawingUpdateInput | TagsInput | TagNameInput | TagMergeInput | ShareLinkInput
 }
 
 type UserInput struct {
-	Name     *string `json:"name" validate:"required,gte=2"`
-	Email    *string `json:"email" validate:"required,email"`
-	Password *string `json:"password" validate:"required,gte=6"`
+	Username  *string `json:"username" validate:"required,gte=2,lte=50"`
+	Email     *string `json:"email" validate:"required,email"`
+	Password  *string `json:"password" validate:"required,gte=6"`
+	Role      *string `json:"role" validate:"omitempty,oneof=buyer artist both admin"`
+	AvatarURL *string `json:"avatar_url" validate:"omitempty,url,lte=255"`
+	Bio       *string `json:"bio"`
 }
 
 type SignInInput struct {
@@ -37,10 +74,54 @@ type SignInInput struct {
 	Password string `json:"password" validate:"required,gte=6"`
 }
 
+type TokenInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type EmailInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,gte=6"`
+}
+
 func (i UserInput) Validate() error {
 	return validate.Struct(i)
 }
 
+// ValidateUpdate validates the fields that are set, the others are left as they are by a partial update.
+func (i UserInput) ValidateUpdate() error {
+	unset := make([]string, 0, 6)
+	for name, value := range map[string]*string{
+		"Username":  i.Username,
+		"Email":     i.Email,
+		"Password":  i.Password,
+		"Role":      i.Role,
+		"AvatarURL": i.AvatarURL,
+		"Bio":       i.Bio,
+	} {
+		if value == nil {
+			unset = append(unset, name)
+		}
+	}
+
+	return validate.StructExcept(i, unset...)
+}
+
 func (i SignInInput) Validate() error {
 	return validate.Struct(i)
 }
+
+func (i TokenInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i EmailInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i ResetPasswordInput) Validate() error {
+	return validate.Struct(i)
+}
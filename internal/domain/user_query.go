@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidCursor    = errors.New("Invalid cursor")
+	ErrInvalidSortField = errors.New("Invalid sort field")
+)
+
+// Fields users can be sorted by.
+const (
+	UserSortRegisteredAt = "registered_at"
+	UserSortUsername     = "username"
+)
+
+type UserFilter struct {
+	Email          string
+	UsernamePrefix string
+	Role           string
+	RegisteredFrom *time.Time
+	RegisteredTo   *time.Time
+}
+
+// UserCursor is the position after the last user of a page: its value of the sort field and its id.
+type UserCursor struct {
+	Value string
+	ID    string
+}
+
+// UserQuery selects a page of users. With a cursor Offset is ignored.
+type UserQuery struct {
+	Filter UserFilter
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+	// After is the NextCursor of the previous page, the service decodes it into Cursor
+	After  string
+	Cursor *UserCursor
+}
+
+type UserPage struct {
+	Users []User
+	// Total is the number of users matching the filter on all pages
+	Total      int
+	NextCursor string
+}
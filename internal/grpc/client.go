@@ -21,7 +21,7 @@ func NewGrpcClient(addr string) *GrpcClient {
 
 	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
-		log.Println("Не удалось установить соединение: %s", err.Error())
+		log.Printf("Не удалось установить соединение: %s", err.Error())
 	}
 
 	return &GrpcClient{
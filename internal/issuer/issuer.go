@@ -0,0 +1,146 @@
+// Package issuer signs and validates access tokens in-process. It satisfies service.GrpcClient,
+// so the service can run without the external auth service.
+package issuer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Issuer struct {
+	key       *rsa.PrivateKey
+	kid       string
+	name      string
+	accessTTL time.Duration
+}
+
+// New loads the RSA signing key from a PEM file. Without a file an ephemeral key is generated,
+// which is fine for local development but invalidates all access tokens on restart.
+func New(privateKeyFile string, name string, accessTTL time.Duration) (*Issuer, error) {
+	key, err := loadKey(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		key:       key,
+		kid:       keyId(&key.PublicKey),
+		name:      name,
+		accessTTL: accessTTL,
+	}, nil
+}
+
+func loadKey(privateKeyFile string) (*rsa.PrivateKey, error) {
+	if privateKeyFile == "" {
+		log.Println("issuer: no private key configured, generating an ephemeral one")
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("issuer: private key file is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("issuer: private key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("issuer: unsupported PEM block %s", block.Type)
+	}
+}
+
+// keyId derives a stable kid from the public key, so a rotated key gets a new kid.
+func keyId(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// GenerateToken signs an access token for the user. The second value is always empty:
+// refresh tokens are issued and stored by service.AuthService.
+func (i *Issuer) GenerateToken(ctx context.Context, userId int64) (string, string, error) {
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   strconv.FormatInt(userId, 10),
+		Issuer:    i.name,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.accessTTL).Unix(),
+	})
+	token.Header["kid"] = i.kid
+
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return signed, "", nil
+}
+
+func (i *Issuer) ParseToken(ctx context.Context, token string) (int64, error) {
+	claims := jwt.StandardClaims{}
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+		return &i.key.PublicKey, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.Issuer != i.name {
+		return 0, errors.New("token is issued by someone else")
+	}
+
+	return strconv.ParseInt(claims.Subject, 10, 64)
+}
+
+// JWKSHandler publishes the public key, so other services can verify the tokens.
+func (i *Issuer) JWKSHandler() http.Handler {
+	body, _ := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": i.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.PublicKey.E)).Bytes()),
+		}},
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,56 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+)
+
+type ActionTokens struct {
+	db *sql.DB
+}
+
+func NewActionTokensRepository(db *sql.DB) *ActionTokens {
+	return &ActionTokens{db: db}
+}
+
+func (r *ActionTokens) Create(token domain.ActionToken) error {
+	_, err := r.db.Exec("INSERT INTO users.action_tokens (token_hash, user_id, purpose, expires_at) values ($1, $2, $3, $4)",
+		token.TokenHash, token.UserID, token.Purpose, token.ExpiresAt)
+	return err
+}
+
+// Consume marks the token used and returns it, in one statement so a token can't be used twice.
+// Unknown, expired, used and foreign-purpose tokens all give domain.ErrInvalidToken.
+func (r *ActionTokens) Consume(tokenHash string, purpose string) (domain.ActionToken, error) {
+	var t domain.ActionToken
+	err := r.db.QueryRow(`UPDATE users.action_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING token_hash, user_id, purpose, expires_at, used_at`, tokenHash, purpose).
+		Scan(&t.TokenHash, &t.UserID, &t.Purpose, &t.ExpiresAt, &t.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, domain.ErrInvalidToken
+	}
+
+	return t, err
+}
+
+// Invalidate expires every unused token of the user for the purpose, e.g. when a new one is sent.
+func (r *ActionTokens) Invalidate(userId string, purpose string) error {
+	_, err := r.db.Exec("UPDATE users.action_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userId, purpose)
+	return err
+}
+
+// Get returns a token that is still usable without consuming it.
+func (r *ActionTokens) Get(tokenHash string, purpose string) (domain.ActionToken, error) {
+	var t domain.ActionToken
+	err := r.db.QueryRow(`SELECT token_hash, user_id, purpose, expires_at, used_at FROM users.action_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()`, tokenHash, purpose).
+		Scan(&t.TokenHash, &t.UserID, &t.Purpose, &t.ExpiresAt, &t.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, domain.ErrInvalidToken
+	}
+
+	return t, err
+}
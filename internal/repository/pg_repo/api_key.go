@@ -0,0 +1,82 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = "key_id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+type APIKeys struct {
+	db *sql.DB
+}
+
+func NewAPIKeysRepository(db *sql.DB) *APIKeys {
+	return &APIKeys{db: db}
+}
+
+func scanAPIKey(row rowScanner) (domain.APIKey, error) {
+	var k domain.APIKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes),
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+	return k, err
+}
+
+func (r *APIKeys) Create(key domain.APIKey) (domain.APIKey, error) {
+	created, err := scanAPIKey(r.db.QueryRow(`INSERT INTO users.api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (prefix) DO NOTHING RETURNING `+apiKeyColumns,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return created, domain.ErrAPIKeyPrefixTaken
+	}
+	return created, err
+}
+
+func (r *APIKeys) GetByPrefix(prefix string) (domain.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM users.api_keys WHERE prefix = $1", prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, domain.ErrInvalidAPIKey
+	}
+	return key, err
+}
+
+func (r *APIKeys) ListByUser(userId string) ([]domain.APIKey, error) {
+	rows, err := r.db.Query("SELECT "+apiKeyColumns+" FROM users.api_keys WHERE user_id = $1 ORDER BY created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := make([]domain.APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeys) Revoke(userId string, id string) error {
+	res, err := r.db.Exec("UPDATE users.api_keys SET revoked_at = now() WHERE key_id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		id, userId)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrAPIKeyNotFound)
+}
+
+func (r *APIKeys) TouchLastUsed(id string) error {
+	_, err := r.db.Exec("UPDATE users.api_keys SET last_used_at = now() WHERE key_id = $1", id)
+	return err
+}
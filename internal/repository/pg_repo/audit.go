@@ -0,0 +1,118 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"strings"
+)
+
+type AuditEvents struct {
+	db *sql.DB
+}
+
+func NewAuditEventsRepository(db *sql.DB) *AuditEvents {
+	return &AuditEvents{db: db}
+}
+
+func (r *AuditEvents) Append(event domain.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`INSERT INTO users.audit_events (actor_id, target_id, action, ip, user_agent, outcome, metadata)
+		values ($1, $2, $3, $4, $5, $6, $7)`,
+		nullString(event.ActorID), nullString(event.TargetID), event.Action,
+		nullString(event.IP), nullString(event.UserAgent), event.Outcome, metadata)
+	return err
+}
+
+func (r *AuditEvents) List(filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	events := make([]domain.AuditEvent, 0)
+	err := r.Each(filter, func(e domain.AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+
+	return events, err
+}
+
+// Each calls fn for every matching event without loading them all into memory.
+func (r *AuditEvents) Each(filter domain.AuditFilter, fn func(domain.AuditEvent) error) error {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if filter.UserID != "" {
+		conditions = append(conditions, fmt.Sprintf("(actor_id = $%d OR target_id = $%d)", argId, argId))
+		args = append(args, filter.UserID)
+		argId++
+	}
+
+	if filter.Action != "" {
+		conditions = append(conditions, fmt.Sprintf("action = $%d", argId))
+		args = append(args, filter.Action)
+		argId++
+	}
+
+	if filter.From != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argId))
+		args = append(args, *filter.From)
+		argId++
+	}
+
+	if filter.To != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argId))
+		args = append(args, *filter.To)
+		argId++
+	}
+
+	if filter.Before > 0 {
+		conditions = append(conditions, fmt.Sprintf("event_id < $%d", argId))
+		args = append(args, filter.Before)
+		argId++
+	}
+
+	query := `SELECT event_id, actor_id, target_id, action, ip, user_agent, outcome, metadata, created_at
+		FROM users.audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY event_id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argId)
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.AuditEvent
+		var actorId, targetId, ip, userAgent sql.NullString
+		var metadata []byte
+		if err := rows.Scan(&e.ID, &actorId, &targetId, &e.Action, &ip, &userAgent, &e.Outcome, &metadata, &e.CreatedAt); err != nil {
+			return err
+		}
+		e.ActorID, e.TargetID, e.IP, e.UserAgent = actorId.String, targetId.String, ip.String, userAgent.String
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -2,8 +2,8 @@ package pg_repo
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/dankru/Commissions_simple/internal/domain"
-	"time"
 )
 
 type AuthRepository struct {
@@ -11,25 +11,92 @@ type AuthRepository struct {
 }
 
 type UserRepository interface {
-	CreateUser(user domain.User) error
-	GetByCredentials(email string, hashedPassword string) (domain.User, error)
+	CreateUser(user domain.User) (string, error)
+	GetByEmail(email string) (domain.User, error)
+	GetById(id string) (domain.User, error)
+	GetIdByAuthId(authId int64) (string, error)
+	GetAuthId(id string) (int64, error)
+	UpdatePassword(id string, passwordHash string) error
+	ResetPassword(tokenHash string, passwordHash string) error
+	MarkEmailVerified(id string) error
 }
 
 func NewAuthRepository(db *sql.DB) *AuthRepository {
 	return &AuthRepository{db: db}
 }
 
-func (repo *AuthRepository) CreateUser(user domain.User) error {
-	_, err := repo.db.Exec("insert into users (name, email, password, registered_at) values ($1, $2, $3, $4)",
-		user.Name, user.Email, user.Password, time.Now())
+func (repo *AuthRepository) CreateUser(user domain.User) (string, error) {
+	var id string
+	err := repo.db.QueryRow(`insert into users.users (username, email, password_hash, role, avatar_url, bio)
+		values ($1, $2, $3, $4, $5, $6) returning user_id`,
+		user.Username, user.Email, user.Password, user.Role, user.AvatarURL, user.Bio).Scan(&id)
+	return id, err
+}
+
+func (repo *AuthRepository) GetByEmail(email string) (domain.User, error) {
+	return scanUser(repo.db.QueryRow("SELECT "+userColumns+" FROM users.users WHERE email=$1", email))
+}
+
+func (repo *AuthRepository) GetById(id string) (domain.User, error) {
+	return scanUser(repo.db.QueryRow("SELECT "+userColumns+" FROM users.users WHERE user_id=$1", id))
+}
+
+func (repo *AuthRepository) GetIdByAuthId(authId int64) (string, error) {
+	var id string
+	err := repo.db.QueryRow("SELECT user_id FROM users.users WHERE auth_id=$1", authId).Scan(&id)
+	return id, err
+}
+
+func (repo *AuthRepository) UpdatePassword(id string, passwordHash string) error {
+	_, err := repo.db.Exec("update users.users set password_hash = $1, updated_at = now() where user_id = $2", passwordHash, id)
 	return err
 }
 
-func (repo *AuthRepository) GetByCredentials(email string, hashedPassword string) (domain.User, error) {
-	var user domain.User
-	err := repo.db.QueryRow("SELECT id, name, email, password, registered_at FROM users WHERE email=$1 AND password=$2",
-		email, hashedPassword).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.RegisteredAt)
+// ResetPassword redeems the password reset token and, in the same transaction, sets the password,
+// expires the other reset tokens, revokes all refresh tokens and marks the email verified.
+func (repo *AuthRepository) ResetPassword(tokenHash string, passwordHash string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userId string
+	err = tx.QueryRow(`UPDATE users.action_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`, tokenHash, domain.PurposePasswordReset).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
 
-	return user, err
+	if _, err := tx.Exec(`update users.users set password_hash = $1, updated_at = now(),
+		email_verified_at = coalesce(email_verified_at, now()) where user_id = $2`, passwordHash, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users.action_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userId, domain.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users.refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL",
+		userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *AuthRepository) GetAuthId(id string) (int64, error) {
+	var authId int64
+	err := repo.db.QueryRow("SELECT auth_id FROM users.users WHERE user_id=$1", id).Scan(&authId)
+	return authId, err
+}
+
+func (repo *AuthRepository) MarkEmailVerified(id string) error {
+	_, err := repo.db.Exec("update users.users set email_verified_at = now() where user_id = $1 and email_verified_at is null", id)
+	return err
 }
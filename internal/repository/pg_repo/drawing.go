@@ -0,0 +1,227 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/lib/pq"
+	"strings"
+)
+
+const drawingColumns = "drawing_id, artist_id, title, description, file_path, storage_provider, visibility, content_type, size_bytes, share_version, created_at, updated_at"
+
+type Drawings struct {
+	db *sql.DB
+}
+
+func NewDrawingsRepository(db *sql.DB) *Drawings {
+	return &Drawings{db: db}
+}
+
+func scanDrawing(row rowScanner) (domain.Drawing, error) {
+	var d domain.Drawing
+	err := row.Scan(&d.ID, &d.ArtistID, &d.Title, &d.Description, &d.FilePath, &d.StorageProvider, &d.Visibility,
+		&d.ContentType, &d.Size, &d.ShareVersion, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+func (r *Drawings) Create(drawing domain.Drawing) (domain.Drawing, error) {
+	return scanDrawing(r.db.QueryRow(`INSERT INTO drawings.drawings
+		(artist_id, title, description, file_path, storage_provider, visibility, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+drawingColumns,
+		drawing.ArtistID, drawing.Title, drawing.Description, drawing.FilePath, drawing.StorageProvider,
+		drawing.Visibility, drawing.ContentType, drawing.Size))
+}
+
+func (r *Drawings) GetById(id string) (domain.Drawing, error) {
+	drawing, err := scanDrawing(r.db.QueryRow("SELECT "+drawingColumns+" FROM drawings.drawings WHERE drawing_id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return drawing, domain.ErrDrawingNotFound
+	}
+	return drawing, err
+}
+
+// List returns the drawings matching the filter, newest first.
+func (r *Drawings) List(filter domain.DrawingFilter) ([]domain.Drawing, error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if filter.ArtistID != "" {
+		conditions = append(conditions, fmt.Sprintf("artist_id = $%d", argId))
+		args = append(args, filter.ArtistID)
+		argId++
+	}
+
+	if filter.PublicOrOwnedBy != "" {
+		conditions = append(conditions, fmt.Sprintf("(visibility = 'public' OR artist_id = $%d)", argId))
+		args = append(args, filter.PublicOrOwnedBy)
+		argId++
+	} else {
+		conditions = append(conditions, "visibility = 'public'")
+	}
+
+	if len(filter.Tags) > 0 && filter.MatchAllTags {
+		for _, tag := range filter.Tags {
+			conditions = append(conditions, fmt.Sprintf(`EXISTS (SELECT 1 FROM drawings.drawings_tags dt
+				WHERE dt.drawing_id = drawings.drawing_id AND dt.tag_id IN (%s))`, resolveTagsSQL(fmt.Sprintf("= $%d", argId))))
+			args = append(args, tag)
+			argId++
+		}
+	} else if len(filter.Tags) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (SELECT 1 FROM drawings.drawings_tags dt
+			WHERE dt.drawing_id = drawings.drawing_id AND dt.tag_id IN (%s))`, resolveTagsSQL(fmt.Sprintf("= ANY($%d)", argId))))
+		args = append(args, pq.Array(filter.Tags))
+		argId++
+	}
+
+	query := "SELECT " + drawingColumns + " FROM drawings.drawings"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, drawing_id DESC LIMIT $%d OFFSET $%d", argId, argId+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	drawings := make([]domain.Drawing, 0)
+	for rows.Next() {
+		d, err := scanDrawing(rows)
+		if err != nil {
+			return nil, err
+		}
+		drawings = append(drawings, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drawings, nil
+}
+
+func (r *Drawings) Update(id string, input domain.DrawingUpdateInput) (domain.Drawing, error) {
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if input.Title != nil {
+		setValues = append(setValues, fmt.Sprintf("title = $%d", argId))
+		args = append(args, *input.Title)
+		argId++
+	}
+
+	if input.Description != nil {
+		setValues = append(setValues, fmt.Sprintf("description = $%d", argId))
+		args = append(args, *input.Description)
+		argId++
+	}
+
+	if input.Visibility != nil {
+		setValues = append(setValues, fmt.Sprintf("visibility = $%d", argId))
+		args = append(args, *input.Visibility)
+		argId++
+	}
+
+	setValues = append(setValues, "updated_at = now()")
+
+	query := fmt.Sprintf("UPDATE drawings.drawings SET %s WHERE drawing_id = $%d RETURNING %s",
+		strings.Join(setValues, ", "), argId, drawingColumns)
+	args = append(args, id)
+
+	drawing, err := scanDrawing(r.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return drawing, domain.ErrDrawingNotFound
+	}
+	return drawing, err
+}
+
+func (r *Drawings) Delete(id string) error {
+	res, err := r.db.Exec("DELETE FROM drawings.drawings WHERE drawing_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrDrawingNotFound)
+}
+
+// RotateShareVersion invalidates the share links of the drawing and returns the new version.
+func (r *Drawings) RotateShareVersion(id string) (int, error) {
+	var version int
+	err := r.db.QueryRow(`UPDATE drawings.drawings SET share_version = share_version + 1, updated_at = now()
+		WHERE drawing_id = $1 RETURNING share_version`, id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, domain.ErrDrawingNotFound
+	}
+	return version, err
+}
+
+// TagsOf returns the tag names of the drawings, keyed by drawing id, in alphabetical order.
+func (r *Drawings) TagsOf(ids []string) (map[string][]string, error) {
+	rows, err := r.db.Query(`SELECT dt.drawing_id, t.tag_name FROM drawings.drawings_tags dt
+		JOIN drawings.tags t ON t.tag_id = dt.tag_id
+		WHERE dt.drawing_id = ANY($1::uuid[]) ORDER BY t.tag_name`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := make(map[string][]string, len(ids))
+	for rows.Next() {
+		var drawingId, name string
+		if err := rows.Scan(&drawingId, &name); err != nil {
+			return nil, err
+		}
+		tags[drawingId] = append(tags[drawingId], name)
+	}
+
+	return tags, rows.Err()
+}
+
+// ListByProvider returns the drawings stored with the provider in the order of their ids, starting after afterId.
+func (r *Drawings) ListByProvider(provider string, afterId string, limit int) ([]domain.Drawing, error) {
+	if afterId == "" {
+		afterId = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := r.db.Query("SELECT "+drawingColumns+` FROM drawings.drawings
+		WHERE storage_provider = $1 AND drawing_id > $2 ORDER BY drawing_id LIMIT $3`, provider, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	drawings := make([]domain.Drawing, 0)
+	for rows.Next() {
+		d, err := scanDrawing(rows)
+		if err != nil {
+			return nil, err
+		}
+		drawings = append(drawings, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drawings, nil
+}
+
+// ChangeStorageProvider switches the drawing to another provider, unless it has been moved or deleted meanwhile.
+func (r *Drawings) ChangeStorageProvider(id string, from string, to string) error {
+	res, err := r.db.Exec("UPDATE drawings.drawings SET storage_provider = $1 WHERE drawing_id = $2 AND storage_provider = $3",
+		to, id, from)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrDrawingNotFound)
+}
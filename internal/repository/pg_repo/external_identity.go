@@ -0,0 +1,115 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+)
+
+type ExternalIdentities struct {
+	db *sql.DB
+}
+
+func NewExternalIdentitiesRepository(db *sql.DB) *ExternalIdentities {
+	return &ExternalIdentities{db: db}
+}
+
+func (r *ExternalIdentities) CreateState(state domain.OIDCState) error {
+	_, err := r.db.Exec(`INSERT INTO users.oidc_states (state_hash, provider, nonce, code_verifier, expires_at)
+		values ($1, $2, $3, $4, $5)`,
+		state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeState deletes the state and returns it, so every login can be finished only once.
+// Expired states of all logins are cleaned up on the way.
+func (r *ExternalIdentities) ConsumeState(stateHash string, provider string) (domain.OIDCState, error) {
+	if _, err := r.db.Exec("DELETE FROM users.oidc_states WHERE expires_at <= now()"); err != nil {
+		return domain.OIDCState{}, err
+	}
+
+	var s domain.OIDCState
+	err := r.db.QueryRow(`DELETE FROM users.oidc_states WHERE state_hash = $1 AND provider = $2 AND expires_at > now()
+		RETURNING state_hash, provider, nonce, code_verifier, expires_at`, stateHash, provider).
+		Scan(&s.StateHash, &s.Provider, &s.Nonce, &s.CodeVerifier, &s.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, domain.ErrInvalidOIDCState
+	}
+
+	return s, err
+}
+
+// GetUserId returns the user the identity is linked to and records the login.
+func (r *ExternalIdentities) GetUserId(provider string, subject string) (string, error) {
+	var userId string
+	err := r.db.QueryRow(`UPDATE users.external_identities SET last_login_at = now()
+		WHERE provider = $1 AND subject = $2 RETURNING user_id`, provider, subject).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrUserNotFound
+	}
+
+	return userId, err
+}
+
+func (r *ExternalIdentities) Link(identity domain.ExternalIdentity) error {
+	_, err := r.db.Exec(`INSERT INTO users.external_identities (provider, subject, user_id, email, last_login_at)
+		values ($1, $2, $3, $4, now()) ON CONFLICT (provider, subject) DO NOTHING`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email)
+	return err
+}
+
+// CreateUser creates a user with a verified email together with the identity it signs in with.
+// A taken username gives domain.ErrUsernameTaken, so the caller can try another one.
+func (r *ExternalIdentities) CreateUser(user domain.User, identity domain.ExternalIdentity) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`INSERT INTO users.users (username, email, password_hash, role, avatar_url, bio, email_verified_at)
+		values ($1, $2, $3, $4, $5, $6, now()) ON CONFLICT (username) DO NOTHING RETURNING user_id`,
+		user.Username, user.Email, user.Password, user.Role, user.AvatarURL, user.Bio).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrUsernameTaken
+		}
+		return "", err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO users.external_identities (provider, subject, user_id, email, last_login_at)
+		values ($1, $2, $3, $4, now())`,
+		identity.Provider, identity.Subject, id, identity.Email); err != nil {
+		return "", err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *ExternalIdentities) ListByUser(userId string) ([]domain.ExternalIdentity, error) {
+	rows, err := r.db.Query(`SELECT provider, subject, user_id, email, created_at, last_login_at
+		FROM users.external_identities WHERE user_id = $1 ORDER BY created_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	identities := make([]domain.ExternalIdentity, 0)
+	for rows.Next() {
+		var i domain.ExternalIdentity
+		var email sql.NullString
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.UserID, &email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		i.Email = email.String
+		identities = append(identities, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,53 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type LoginAttempts struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptsRepository(db *sql.DB) *LoginAttempts {
+	return &LoginAttempts{db: db}
+}
+
+// LockedUntil returns the zero time when the key isn't locked.
+func (r *LoginAttempts) LockedUntil(scope string, key string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRow("SELECT locked_until FROM users.login_attempts WHERE scope = $1 AND key = $2", scope, key).
+		Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+
+	return lockedUntil.Time, err
+}
+
+// RegisterFailure counts a failed attempt and returns the number of failures in a row.
+// The count starts over when the previous failure is older than window.
+func (r *LoginAttempts) RegisterFailure(scope string, key string, window time.Duration) (int, error) {
+	var failures int
+	err := r.db.QueryRow(`INSERT INTO users.login_attempts (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, now())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < now() - make_interval(secs => $3)
+				THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = now()
+		RETURNING failures`, scope, key, window.Seconds()).Scan(&failures)
+
+	return failures, err
+}
+
+func (r *LoginAttempts) Lock(scope string, key string, until time.Time) error {
+	_, err := r.db.Exec("UPDATE users.login_attempts SET locked_until = $3 WHERE scope = $1 AND key = $2",
+		scope, key, until)
+	return err
+}
+
+func (r *LoginAttempts) Reset(scope string, key string) error {
+	_, err := r.db.Exec("DELETE FROM users.login_attempts WHERE scope = $1 AND key = $2", scope, key)
+	return err
+}
@@ -0,0 +1,115 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"github.com/dankru/Commissions_simple/internal/domain"
+)
+
+type MFA struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFA {
+	return &MFA{db: db}
+}
+
+func (r *MFA) GetTOTP(userId string) (domain.TOTP, error) {
+	var t domain.TOTP
+	var secret sql.NullString
+	err := r.db.QueryRow("SELECT totp_secret, totp_enabled_at, totp_last_step FROM users.users WHERE user_id = $1", userId).
+		Scan(&secret, &t.EnabledAt, &t.LastStep)
+	t.Secret = secret.String
+	return t, err
+}
+
+// SetPendingSecret stores a secret that is not enabled yet. It fails when 2FA is already enabled.
+func (r *MFA) SetPendingSecret(userId string, secret string) error {
+	res, err := r.db.Exec(`UPDATE users.users SET totp_secret = $2, totp_last_step = 0
+		WHERE user_id = $1 AND totp_enabled_at IS NULL`, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrMFAAlreadyEnabled)
+}
+
+func (r *MFA) Enable(userId string) error {
+	_, err := r.db.Exec("UPDATE users.users SET totp_enabled_at = now() WHERE user_id = $1 AND totp_secret IS NOT NULL", userId)
+	return err
+}
+
+// UseStep records step as the last accepted one. It returns false when that step or a later one
+// was already used, i.e. the code is being replayed.
+func (r *MFA) UseStep(userId string, step int64) (bool, error) {
+	res, err := r.db.Exec("UPDATE users.users SET totp_last_step = $2 WHERE user_id = $1 AND totp_last_step < $2", userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// ReplaceRecoveryCodes drops the previous codes of the user and stores the new ones.
+func (r *MFA) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM users.recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO users.recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, codeHash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the code used and reports whether it was valid.
+func (r *MFA) UseRecoveryCode(userId string, codeHash string) (bool, error) {
+	res, err := r.db.Exec(`UPDATE users.recovery_codes SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// Reset disables 2FA and removes the secret and recovery codes.
+func (r *MFA) Reset(userId string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users.users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM users.recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func expectAffected(res sql.Result, errNone error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNone
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+)
+
+const reviewColumns = "review_id, reviewer_id, reviewee_id, rating, comment, created_at, updated_at"
+
+type Reviews struct {
+	db *sql.DB
+}
+
+func NewReviewsRepository(db *sql.DB) *Reviews {
+	return &Reviews{db: db}
+}
+
+func scanReview(row rowScanner) (domain.Review, error) {
+	var r domain.Review
+	err := row.Scan(&r.ID, &r.ReviewerID, &r.RevieweeID, &r.Rating, &r.Comment, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// Create returns domain.ErrDuplicateReview when the reviewer has already reviewed the user.
+func (r *Reviews) Create(review domain.Review) (domain.Review, error) {
+	created, err := scanReview(r.db.QueryRow(`INSERT INTO users.user_reviews (reviewer_id, reviewee_id, rating, comment)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (reviewer_id, reviewee_id) DO NOTHING
+		RETURNING `+reviewColumns,
+		review.ReviewerID, review.RevieweeID, review.Rating, review.Comment))
+	if errors.Is(err, sql.ErrNoRows) {
+		return created, domain.ErrDuplicateReview
+	}
+	return created, err
+}
+
+func (r *Reviews) GetById(revieweeId string, id int64) (domain.Review, error) {
+	review, err := scanReview(r.db.QueryRow("SELECT "+reviewColumns+" FROM users.user_reviews WHERE review_id = $1 AND reviewee_id = $2",
+		id, revieweeId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return review, domain.ErrReviewNotFound
+	}
+	return review, err
+}
+
+// ListByReviewee returns the reviews of the user, newest first.
+func (r *Reviews) ListByReviewee(revieweeId string, limit int, offset int) ([]domain.Review, error) {
+	rows, err := r.db.Query("SELECT "+reviewColumns+` FROM users.user_reviews WHERE reviewee_id = $1
+		ORDER BY created_at DESC, review_id DESC LIMIT $2 OFFSET $3`, revieweeId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reviews := make([]domain.Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// Update changes the review only if it's the one of review.ReviewerID about review.RevieweeID.
+func (r *Reviews) Update(review domain.Review) (domain.Review, error) {
+	updated, err := scanReview(r.db.QueryRow(`UPDATE users.user_reviews SET rating = $1, comment = $2, updated_at = now()
+		WHERE review_id = $3 AND reviewee_id = $4 AND reviewer_id = $5 RETURNING `+reviewColumns,
+		review.Rating, review.Comment, review.ID, review.RevieweeID, review.ReviewerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return updated, domain.ErrReviewNotFound
+	}
+	return updated, err
+}
+
+// Delete removes the review of the user. A non-empty reviewerId limits it to the reviewer's own review.
+func (r *Reviews) Delete(revieweeId string, id int64, reviewerId string) error {
+	query := "DELETE FROM users.user_reviews WHERE review_id = $1 AND reviewee_id = $2"
+	args := []any{id, revieweeId}
+	if reviewerId != "" {
+		query += " AND reviewer_id = $3"
+		args = append(args, reviewerId)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrReviewNotFound)
+}
+
+func (r *Reviews) Summary(revieweeId string) (domain.RatingSummary, error) {
+	rows, err := r.db.Query("SELECT rating, count(*) FROM users.user_reviews WHERE reviewee_id = $1 GROUP BY rating", revieweeId)
+	if err != nil {
+		return domain.RatingSummary{}, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var rating, count int
+		if err := rows.Scan(&rating, &count); err != nil {
+			return domain.RatingSummary{}, err
+		}
+		counts[rating] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return domain.RatingSummary{}, err
+	}
+
+	return domain.NewRatingSummary(counts), nil
+}
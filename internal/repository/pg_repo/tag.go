@@ -0,0 +1,285 @@
+package pg_repo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/lib/pq"
+)
+
+type Tags struct {
+	db *sql.DB
+}
+
+func NewTagsRepository(db *sql.DB) *Tags {
+	return &Tags{db: db}
+}
+
+// resolveTagsSQL selects the ids of the tags whose name or alias matches the condition, e.g. "= $1".
+func resolveTagsSQL(condition string) string {
+	return "SELECT tag_id FROM drawings.tags WHERE tag_name " + condition +
+		" UNION SELECT tag_id FROM drawings.tag_aliases WHERE alias " + condition
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// resolveTag returns the id of the tag with the name or alias.
+func resolveTag(q queryer, name string) (int64, error) {
+	var id int64
+	err := q.QueryRow(resolveTagsSQL("= $1"), name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, domain.ErrTagNotFound
+	}
+	return id, err
+}
+
+// nameTaken reports whether a tag other than exceptId, or an alias, is called name.
+func nameTaken(q queryer, name string, exceptId int64) (bool, error) {
+	var taken bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM drawings.tags WHERE tag_name = $1 AND tag_id <> $2)
+		OR EXISTS (SELECT 1 FROM drawings.tag_aliases WHERE alias = $1)`, name, exceptId).Scan(&taken)
+	return taken, err
+}
+
+// lockTagNames serializes the transactions that add tag names and aliases until tx ends. Names and aliases
+// share one namespace, which no unique constraint covers, so the check of nameTaken holds only under the lock.
+func lockTagNames(tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('drawings.tag_names'))")
+	return err
+}
+
+// Attach adds the tags to the drawing, creating the unknown ones. Aliases attach the tag they stand for.
+// It fails with domain.ErrTooManyTags when the drawing would have more than domain.MaxTagsPerDrawing tags.
+func (r *Tags) Attach(drawingId string, names []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range names {
+		id, err := resolveTag(tx, name)
+		if errors.Is(err, domain.ErrTagNotFound) {
+			// another transaction may have just added the name as an alias
+			if err = lockTagNames(tx); err == nil {
+				id, err = resolveTag(tx, name)
+			}
+		}
+		if errors.Is(err, domain.ErrTagNotFound) {
+			err = tx.QueryRow(`INSERT INTO drawings.tags (tag_name) VALUES ($1)
+				ON CONFLICT (tag_name) DO UPDATE SET tag_name = EXCLUDED.tag_name RETURNING tag_id`, name).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`INSERT INTO drawings.drawings_tags (drawing_id, tag_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, drawingId, id); err != nil {
+			return err
+		}
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM drawings.drawings_tags WHERE drawing_id = $1", drawingId).Scan(&count); err != nil {
+		return err
+	}
+	if count > domain.MaxTagsPerDrawing {
+		return domain.ErrTooManyTags
+	}
+
+	return tx.Commit()
+}
+
+func (r *Tags) Detach(drawingId string, name string) error {
+	id, err := resolveTag(r.db, name)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec("DELETE FROM drawings.drawings_tags WHERE drawing_id = $1 AND tag_id = $2", drawingId, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrTagNotFound)
+}
+
+// Autocomplete returns the tags whose name or one of whose aliases starts with prefix, most used first.
+// Only public drawings are counted, and tags used on nothing else aren't suggested, so they don't give away
+// private and link-only drawings.
+func (r *Tags) Autocomplete(prefix string, limit int) ([]domain.Tag, error) {
+	rows, err := r.db.Query(`SELECT t.tag_id, t.tag_name, count(d.drawing_id) AS uses
+		FROM drawings.tags t
+		LEFT JOIN drawings.drawings_tags dt ON dt.tag_id = t.tag_id
+		LEFT JOIN drawings.drawings d ON d.drawing_id = dt.drawing_id AND d.visibility = 'public'
+		WHERE t.tag_name LIKE $1 OR t.tag_id IN (SELECT tag_id FROM drawings.tag_aliases WHERE alias LIKE $1)
+		GROUP BY t.tag_id
+		HAVING count(d.drawing_id) > 0 OR count(dt.drawing_id) = 0
+		ORDER BY uses DESC, t.tag_name
+		LIMIT $2`, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := make([]domain.Tag, 0)
+	for rows.Next() {
+		var t domain.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Uses); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (r *Tags) GetById(id int64) (domain.Tag, error) {
+	var t domain.Tag
+	err := r.db.QueryRow(`SELECT t.tag_id, t.tag_name,
+			ARRAY(SELECT alias FROM drawings.tag_aliases a WHERE a.tag_id = t.tag_id ORDER BY alias),
+			(SELECT count(*) FROM drawings.drawings_tags dt
+				JOIN drawings.drawings d ON d.drawing_id = dt.drawing_id AND d.visibility = 'public'
+				WHERE dt.tag_id = t.tag_id)
+		FROM drawings.tags t WHERE t.tag_id = $1`, id).Scan(&t.ID, &t.Name, pq.Array(&t.Aliases), &t.Uses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, domain.ErrTagNotFound
+	}
+	return t, err
+}
+
+// Rename gives the tag a name no other tag or alias has. Renaming a tag to one of its own aliases drops the alias.
+func (r *Tags) Rename(id int64, name string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockTagNames(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM drawings.tag_aliases WHERE alias = $1 AND tag_id = $2", name, id); err != nil {
+		return err
+	}
+
+	taken, err := nameTaken(tx, name, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return domain.ErrTagExists
+	}
+
+	res, err := tx.Exec("UPDATE drawings.tags SET tag_name = $1 WHERE tag_id = $2", name, id)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(res, domain.ErrTagNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Merge moves the drawings and aliases of the source tag to the target and deletes the source.
+// The source's name becomes an alias of the target, so it keeps finding the same drawings.
+func (r *Tags) Merge(sourceId int64, targetId int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockTagNames(tx); err != nil {
+		return err
+	}
+
+	var sourceName string
+	err = tx.QueryRow("SELECT tag_name FROM drawings.tags WHERE tag_id = $1 FOR UPDATE", sourceId).Scan(&sourceName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrTagNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow("SELECT tag_id FROM drawings.tags WHERE tag_id = $1 FOR UPDATE", targetId).Scan(&targetId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrTagNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO drawings.drawings_tags (drawing_id, tag_id)
+		SELECT drawing_id, $2 FROM drawings.drawings_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE drawings.tag_aliases SET tag_id = $2 WHERE tag_id = $1", sourceId, targetId); err != nil {
+		return err
+	}
+
+	// the remaining associations of the source are deleted with it
+	if _, err := tx.Exec("DELETE FROM drawings.tags WHERE tag_id = $1", sourceId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO drawings.tag_aliases (alias, tag_id) VALUES ($1, $2)", sourceName, targetId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddAlias makes the name stand for the tag. It can't be the name of another tag or alias.
+func (r *Tags) AddAlias(id int64, alias string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockTagNames(tx); err != nil {
+		return err
+	}
+
+	taken, err := nameTaken(tx, alias, 0)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return domain.ErrTagExists
+	}
+
+	res, err := tx.Exec(`INSERT INTO drawings.tag_aliases (alias, tag_id)
+		SELECT $1, tag_id FROM drawings.tags WHERE tag_id = $2`, alias, id)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(res, domain.ErrTagNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Tags) RemoveAlias(id int64, alias string) error {
+	res, err := r.db.Exec("DELETE FROM drawings.tag_aliases WHERE alias = $1 AND tag_id = $2", alias, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res, domain.ErrTagNotFound)
+}
@@ -2,9 +2,13 @@ package pg_repo
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/dankru/Commissions_simple/internal/domain"
+	"time"
 )
 
+const refreshSessionColumns = "id, user_id, family_id, token_hash, user_agent, ip, expires_at, created_at, rotated_at, revoked_at"
+
 type Tokens struct {
 	db *sql.DB
 }
@@ -13,22 +17,145 @@ func NewTokensRepository(db *sql.DB) *Tokens {
 	return &Tokens{db}
 }
 
-func (r *Tokens) Create(token domain.RefreshSession) error {
-	_, err := r.db.Exec("INSERT INTO refresh_tokens (user_id, token, expires_at) values ($1, $2, $3)",
-		token.UserID, token.Token, token.ExpiresAt)
+func scanRefreshSession(row rowScanner) (domain.RefreshSession, error) {
+	var t domain.RefreshSession
+	err := row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.Client.UserAgent, &t.Client.IP, &t.ExpiresAt, &t.CreatedAt, &t.RotatedAt, &t.RevokedAt)
+	return t, err
+}
+
+// Create stores the token and returns its family id, a new family is started when token.FamilyID is empty.
+func (r *Tokens) Create(token domain.RefreshSession) (string, error) {
+	familyId := sql.NullString{String: token.FamilyID, Valid: token.FamilyID != ""}
+
+	var id string
+	err := r.db.QueryRow(`INSERT INTO users.refresh_tokens (user_id, family_id, token_hash, user_agent, ip, expires_at)
+		values ($1, COALESCE($2::uuid, gen_random_uuid()), $3, $4, $5, $6) RETURNING family_id`,
+		token.UserID, familyId, token.TokenHash, token.Client.UserAgent, token.Client.IP, token.ExpiresAt).Scan(&id)
+
+	return id, err
+}
+
+func (r *Tokens) GetByToken(tokenHash string) (domain.RefreshSession, error) {
+	return scanRefreshSession(r.db.QueryRow(
+		"SELECT "+refreshSessionColumns+" FROM users.refresh_tokens WHERE token_hash=$1", tokenHash))
+}
+
+// Rotate atomically exchanges the token for next, which joins the same family.
+// Presenting a token that was already rotated revokes the whole family and returns domain.ErrRefreshTokenReused
+// together with the reused session.
+func (r *Tokens) Rotate(tokenHash string, next domain.RefreshSession) (domain.RefreshSession, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.RefreshSession{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := scanRefreshSession(tx.QueryRow(
+		"SELECT "+refreshSessionColumns+" FROM users.refresh_tokens WHERE token_hash=$1 FOR UPDATE", tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return current, domain.ErrInvalidRefreshToken
+		}
+		return current, err
+	}
+
+	if current.RevokedAt != nil {
+		return current, domain.ErrInvalidRefreshToken
+	}
+
+	if current.RotatedAt != nil {
+		if err := revokeFamily(tx, current.FamilyID); err != nil {
+			return current, err
+		}
+		if err := tx.Commit(); err != nil {
+			return current, err
+		}
+		return current, domain.ErrRefreshTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return current, domain.ErrRefreshTokenExpired
+	}
+
+	if _, err := tx.Exec("UPDATE users.refresh_tokens SET rotated_at = now() WHERE id = $1", current.ID); err != nil {
+		return current, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO users.refresh_tokens (user_id, family_id, token_hash, user_agent, ip, expires_at)
+		values ($1, $2, $3, $4, $5, $6)`,
+		current.UserID, current.FamilyID, next.TokenHash, next.Client.UserAgent, next.Client.IP, next.ExpiresAt); err != nil {
+		return current, err
+	}
+
+	return current, tx.Commit()
+}
+
+func (r *Tokens) RevokeFamily(familyId string) error {
+	return revokeFamily(r.db, familyId)
+}
 
+// RevokeUserFamily revokes a family only if it belongs to the user.
+func (r *Tokens) RevokeUserFamily(userId string, familyId string) error {
+	res, err := r.db.Exec(`UPDATE users.refresh_tokens SET revoked_at = now()
+		WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL`, userId, familyId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *Tokens) RevokeAll(userId string) error {
+	_, err := r.db.Exec("UPDATE users.refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL",
+		userId)
 	return err
 }
 
-func (r *Tokens) Get(token string) (domain.RefreshSession, error) {
-	var t domain.RefreshSession
-	err := r.db.QueryRow("SELECT id, user_id, token, expires_at FROM refresh_tokens WHERE token=$1", token).
-		Scan(&t.ID, &t.UserID, &t.Token, &t.ExpiresAt)
+// ListActive returns one entry per family that still has a usable token.
+// The usable token is the latest one, so its creation time is when the session was last refreshed.
+func (r *Tokens) ListActive(userId string) ([]domain.Session, error) {
+	rows, err := r.db.Query(`SELECT t.family_id, t.ip, t.user_agent, f.created_at, t.created_at
+		FROM users.refresh_tokens t
+		JOIN (SELECT family_id, min(created_at) AS created_at FROM users.refresh_tokens WHERE user_id = $1 GROUP BY family_id) f
+			ON f.family_id = t.family_id
+		WHERE t.user_id = $1 AND t.rotated_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > now()
+		ORDER BY t.created_at DESC`, userId)
 	if err != nil {
-		return t, err
+		return nil, err
 	}
 
-	_, err = r.db.Exec("DELETE FROM refresh_tokens WHERE user_id=$1", t.UserID)
+	defer rows.Close()
 
-	return t, err
+	sessions := make([]domain.Session, 0)
+	for rows.Next() {
+		var s domain.Session
+		if err := rows.Scan(&s.ID, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func revokeFamily(db execer, familyId string) error {
+	_, err := db.Exec("UPDATE users.refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL",
+		familyId)
+	return err
 }
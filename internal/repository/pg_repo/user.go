@@ -4,9 +4,15 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/lib/pq"
 	"strings"
 )
 
+// userColumns ends with the account lockout, which is kept by the normalized email.
+const userColumns = `user_id, auth_id, username, email, password_hash, role, avatar_url, bio, created_at, updated_at, email_verified_at, totp_enabled_at,
+	COALESCE((SELECT la.failures FROM users.login_attempts la WHERE la.scope = 'account' AND la.key = lower(btrim(users.email))), 0),
+	(SELECT la.locked_until FROM users.login_attempts la WHERE la.scope = 'account' AND la.key = lower(btrim(users.email)))`
+
 type Repository struct {
 	db *sql.DB
 }
@@ -15,8 +21,62 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (repo *Repository) GetAll() ([]domain.User, error) {
-	rows, err := repo.db.Query("select * from users")
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (domain.User, error) {
+	var u domain.User
+	err := row.Scan(&u.ID, &u.AuthID, &u.Username, &u.Email, &u.Password, &u.Role,
+		&u.AvatarURL, &u.Bio, &u.RegisteredAt, &u.UpdatedAt, &u.EmailVerifiedAt, &u.TOTPEnabledAt,
+		&u.FailedSignIns, &u.LockedUntil)
+	return u, err
+}
+
+// userSortColumns whitelists the sort fields, the names never reach the query otherwise.
+var userSortColumns = map[string]string{
+	domain.UserSortRegisteredAt: "created_at",
+	domain.UserSortUsername:     "username",
+}
+
+// List returns a page of users ordered by the sort field, ties broken by id.
+func (repo *Repository) List(query domain.UserQuery) ([]domain.User, error) {
+	column, ok := userSortColumns[query.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %s", query.Sort)
+	}
+
+	conditions, args := userFilterConditions(query.Filter)
+	argId := len(args) + 1
+
+	order, compare := "ASC", ">"
+	if query.Desc {
+		order, compare = "DESC", "<"
+	}
+
+	if query.Cursor != nil {
+		cast := ""
+		if column == "created_at" {
+			cast = "::timestamp"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, user_id) %s ($%d%s, $%d::uuid)", column, compare, argId, cast, argId+1))
+		args = append(args, query.Cursor.Value, query.Cursor.ID)
+		argId += 2
+	}
+
+	sql := "select " + userColumns + " from users.users"
+	if len(conditions) > 0 {
+		sql += " where " + strings.Join(conditions, " and ")
+	}
+	sql += fmt.Sprintf(" order by %s %s, user_id %s limit $%d", column, order, order, argId)
+	args = append(args, query.Limit)
+
+	if query.Cursor == nil && query.Offset > 0 {
+		sql += fmt.Sprintf(" offset $%d", argId+1)
+		args = append(args, query.Offset)
+	}
+
+	rows, err := repo.db.Query(sql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -25,8 +85,7 @@ func (repo *Repository) GetAll() ([]domain.User, error) {
 
 	users := make([]domain.User, 0)
 	for rows.Next() {
-		u := domain.User{}
-		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.RegisteredAt)
+		u, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -40,45 +99,147 @@ func (repo *Repository) GetAll() ([]domain.User, error) {
 	return users, nil
 }
 
-func (repo *Repository) GetById(id int64) (domain.User, error) {
-	var u domain.User
-	err := repo.db.QueryRow("select * from users WHERE id = $1", id).
-		Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.RegisteredAt)
-	return u, err
+func (repo *Repository) Count(filter domain.UserFilter) (int, error) {
+	conditions, args := userFilterConditions(filter)
+
+	sql := "select count(*) from users.users"
+	if len(conditions) > 0 {
+		sql += " where " + strings.Join(conditions, " and ")
+	}
+
+	var total int
+	err := repo.db.QueryRow(sql, args...).Scan(&total)
+	return total, err
+}
+
+func userFilterConditions(filter domain.UserFilter) ([]string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if filter.Email != "" {
+		conditions = append(conditions, fmt.Sprintf("email = $%d", argId))
+		args = append(args, filter.Email)
+		argId++
+	}
+
+	if filter.UsernamePrefix != "" {
+		conditions = append(conditions, fmt.Sprintf("lower(username) like $%d", argId))
+		args = append(args, likePrefix(strings.ToLower(filter.UsernamePrefix)))
+		argId++
+	}
+
+	if filter.Role != "" {
+		conditions = append(conditions, fmt.Sprintf("role = $%d", argId))
+		args = append(args, filter.Role)
+		argId++
+	}
+
+	if filter.RegisteredFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argId))
+		args = append(args, *filter.RegisteredFrom)
+		argId++
+	}
+
+	if filter.RegisteredTo != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argId))
+		args = append(args, *filter.RegisteredTo)
+		argId++
+	}
+
+	return conditions, args
+}
+
+// likePrefix escapes the LIKE wildcards in prefix.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+func (repo *Repository) GetById(id string) (domain.User, error) {
+	return scanUser(repo.db.QueryRow("select "+userColumns+" from users.users WHERE user_id = $1", id))
+}
+
+func (repo *Repository) GetByIds(ids []string) ([]domain.User, error) {
+	rows, err := repo.db.Query("select "+userColumns+" from users.users WHERE user_id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := make([]domain.User, 0, len(ids))
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
 }
 
-func (repo *Repository) Replace(id int64, user domain.User) error {
-	_, err := repo.db.Exec("update users set name = $1, email = $2, password = $3 WHERE id = $4",
-		user.Name, user.Email, user.Password, id)
+// Replace and Update clear email_verified_at when the email changes, the new address has to be verified again.
+func (repo *Repository) Replace(id string, user domain.User) error {
+	_, err := repo.db.Exec(`update users.users
+		set username = $1, email = $2, password_hash = $3, role = $4, avatar_url = $5, bio = $6, updated_at = now(),
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
+		WHERE user_id = $7`,
+		user.Username, user.Email, user.Password, user.Role, user.AvatarURL, user.Bio, id)
 	return err
 }
 
-func (repo *Repository) Update(id int64, userInp domain.UserInput) error {
+func (repo *Repository) Update(id string, userInp domain.UserInput) error {
 	setValues := make([]string, 0)
 	args := make([]interface{}, 0)
 	argId := 1
 
-	if userInp.Name != nil {
-		setValues = append(setValues, fmt.Sprintf("name = $%d", argId))
-		args = append(args, userInp.Name)
+	if userInp.Username != nil {
+		setValues = append(setValues, fmt.Sprintf("username = $%d", argId))
+		args = append(args, userInp.Username)
 		argId++
 	}
 
 	if userInp.Email != nil {
-		setValues = append(setValues, fmt.Sprintf("email = $%d", argId))
+		setValues = append(setValues, fmt.Sprintf("email = $%d", argId),
+			fmt.Sprintf("email_verified_at = CASE WHEN email = $%d THEN email_verified_at END", argId))
 		args = append(args, userInp.Email)
 		argId++
 	}
 
 	if userInp.Password != nil {
-		setValues = append(setValues, fmt.Sprintf("password = $%d", argId))
+		setValues = append(setValues, fmt.Sprintf("password_hash = $%d", argId))
 		args = append(args, userInp.Password)
 		argId++
 	}
 
+	if userInp.Role != nil {
+		setValues = append(setValues, fmt.Sprintf("role = $%d", argId))
+		args = append(args, userInp.Role)
+		argId++
+	}
+
+	if userInp.AvatarURL != nil {
+		setValues = append(setValues, fmt.Sprintf("avatar_url = $%d", argId))
+		args = append(args, userInp.AvatarURL)
+		argId++
+	}
+
+	if userInp.Bio != nil {
+		setValues = append(setValues, fmt.Sprintf("bio = $%d", argId))
+		args = append(args, userInp.Bio)
+		argId++
+	}
+
+	setValues = append(setValues, "updated_at = now()")
+
 	setQuery := strings.Join(setValues, ", ")
 
-	query := fmt.Sprintf("update users set %s where id = $%d", setQuery, argId)
+	query := fmt.Sprintf("update users.users set %s where user_id = $%d", setQuery, argId)
 
 	args = append(args, id)
 
@@ -87,7 +248,7 @@ func (repo *Repository) Update(id int64, userInp domain.UserInput) error {
 	return err
 }
 
-func (repo *Repository) Delete(id int64) error {
-	_, err := repo.db.Exec("delete from users where id = $1", id)
+func (repo *Repository) Delete(id string) error {
+	_, err := repo.db.Exec("delete from users.users where user_id = $1", id)
 	return err
 }
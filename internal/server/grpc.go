@@ -0,0 +1,30 @@
+package server
+
+import (
+	"google.golang.org/grpc"
+	"log"
+	"net"
+)
+
+type GRPCServer struct {
+	addr   string
+	server *grpc.Server
+}
+
+func NewGRPCServer(addr string, server *grpc.Server) *GRPCServer {
+	return &GRPCServer{
+		addr:   addr,
+		server: server,
+	}
+}
+
+func (s *GRPCServer) Run() {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatal("Failed to listen for gRPC ", err.Error())
+	}
+
+	if err := s.server.Serve(listener); err != nil {
+		log.Fatal("Failed to run gRPC server ", err.Error())
+	}
+}
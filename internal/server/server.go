@@ -10,8 +10,8 @@ type Server struct {
 	server http.Server
 }
 
-func NewServer(addr string, writeTimeout, readTimeout, idleTimeout time.Duration, handler http.Handler) Server {
-	server := Server{
+func NewServer(addr string, writeTimeout, readTimeout, idleTimeout time.Duration, handler http.Handler) *Server {
+	server := &Server{
 		server: http.Server{
 			Addr:         addr,
 			WriteTimeout: writeTimeout,
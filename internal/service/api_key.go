@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"log"
+	"strings"
+	"time"
+)
+
+type APIKeysRepository interface {
+	Create(key domain.APIKey) (domain.APIKey, error)
+	GetByPrefix(prefix string) (domain.APIKey, error)
+	ListByUser(userId string) ([]domain.APIKey, error)
+	Revoke(userId string, id string) error
+	TouchLastUsed(id string) error
+}
+
+// API keys look like uk_<prefix>_<secret>. The prefix is stored in plain text to find the key,
+// the whole key is stored hashed.
+const apiKeyPrefixLength = 8
+
+// apiKeyAttempts is how many random prefixes Create tries, a prefix can belong to one key only.
+const apiKeyAttempts = 3
+
+type APIKeyService struct {
+	repository APIKeysRepository
+}
+
+func NewAPIKeyService(repository APIKeysRepository) *APIKeyService {
+	return &APIKeyService{repository: repository}
+}
+
+// Create returns the stored key and the key itself, which is never available again.
+func (s *APIKeyService) Create(userId string, input domain.APIKeyInput) (domain.APIKey, string, error) {
+	for attempt := 0; attempt < apiKeyAttempts; attempt++ {
+		b := make([]byte, apiKeyPrefixLength/2)
+		if _, err := rand.Read(b); err != nil {
+			return domain.APIKey{}, "", err
+		}
+		prefix := hex.EncodeToString(b)
+
+		secret, err := newOpaqueToken()
+		if err != nil {
+			return domain.APIKey{}, "", err
+		}
+
+		plain := domain.APIKeyPrefix + prefix + "_" + secret
+
+		key, err := s.repository.Create(domain.APIKey{
+			UserID:    userId,
+			Name:      input.Name,
+			Prefix:    prefix,
+			KeyHash:   hashToken(plain),
+			Scopes:    input.Scopes,
+			ExpiresAt: input.ExpiresAt,
+		})
+		if errors.Is(err, domain.ErrAPIKeyPrefixTaken) {
+			continue
+		}
+		if err != nil {
+			return domain.APIKey{}, "", err
+		}
+
+		return key, plain, nil
+	}
+
+	return domain.APIKey{}, "", domain.ErrAPIKeyPrefixTaken
+}
+
+func (s *APIKeyService) List(userId string) ([]domain.APIKey, error) {
+	return s.repository.ListByUser(userId)
+}
+
+func (s *APIKeyService) Revoke(userId string, id string) error {
+	return s.repository.Revoke(userId, id)
+}
+
+// Authenticate returns the active key the plain key belongs to.
+func (s *APIKeyService) Authenticate(plain string) (domain.APIKey, error) {
+	rest, ok := strings.CutPrefix(plain, domain.APIKeyPrefix)
+	if !ok {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != apiKeyPrefixLength {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	key, err := s.repository.GetByPrefix(prefix)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashToken(plain))) != 1 {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	if err := s.repository.TouchLastUsed(key.ID); err != nil {
+		log.Printf("failed to update last use of API key %s: %s", key.ID, err.Error())
+	}
+
+	return key, nil
+}
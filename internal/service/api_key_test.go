@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"testing"
+)
+
+// prefixRepository reports the first taken creates as prefix collisions and keeps the rest.
+type prefixRepository struct {
+	APIKeysRepository
+	taken    int
+	prefixes []string
+	keys     map[string]domain.APIKey
+}
+
+func (r *prefixRepository) Create(key domain.APIKey) (domain.APIKey, error) {
+	r.prefixes = append(r.prefixes, key.Prefix)
+	if len(r.prefixes) <= r.taken {
+		return domain.APIKey{}, domain.ErrAPIKeyPrefixTaken
+	}
+	r.keys[key.Prefix] = key
+	return key, nil
+}
+
+func (r *prefixRepository) GetByPrefix(prefix string) (domain.APIKey, error) {
+	key, ok := r.keys[prefix]
+	if !ok {
+		return key, domain.ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func (r *prefixRepository) TouchLastUsed(string) error {
+	return nil
+}
+
+func TestCreateAPIKeyRetriesTakenPrefixes(t *testing.T) {
+	repo := &prefixRepository{taken: apiKeyAttempts - 1, keys: map[string]domain.APIKey{}}
+	keys := NewAPIKeyService(repo)
+
+	key, plain, err := keys.Create("user", domain.APIKeyInput{Name: "ci", Scopes: []string{domain.ScopeUsersRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.prefixes) != apiKeyAttempts || repo.prefixes[0] == key.Prefix {
+		t.Errorf("tried prefixes %v, created %s", repo.prefixes, key.Prefix)
+	}
+
+	if _, err := keys.Authenticate(plain); err != nil {
+		t.Errorf("Authenticate with the created key = %v", err)
+	}
+}
+
+func TestCreateAPIKeyGivesUpOnTakenPrefixes(t *testing.T) {
+	repo := &prefixRepository{taken: apiKeyAttempts, keys: map[string]domain.APIKey{}}
+
+	_, _, err := NewAPIKeyService(repo).Create("user", domain.APIKeyInput{Name: "ci"})
+	if !errors.Is(err, domain.ErrAPIKeyPrefixTaken) {
+		t.Errorf("err = %v, want ErrAPIKeyPrefixTaken", err)
+	}
+	if len(repo.prefixes) != apiKeyAttempts {
+		t.Errorf("tried %d prefixes, want %d", len(repo.prefixes), apiKeyAttempts)
+	}
+}
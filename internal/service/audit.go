@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"log"
+)
+
+type AuditRepository interface {
+	Append(event domain.AuditEvent) error
+	List(filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	Each(filter domain.AuditFilter, fn func(domain.AuditEvent) error) error
+}
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// AuditLog records security relevant events. Writing is best effort: a failed write is logged
+// and never fails the operation being audited.
+type AuditLog struct {
+	repository AuditRepository
+}
+
+func NewAuditLog(repository AuditRepository) *AuditLog {
+	return &AuditLog{repository: repository}
+}
+
+// Record stores the event with the outcome taken from err. The actor and client default to the ones
+// of the request in ctx, see domain.WithActor and domain.WithClientInfo.
+func (a *AuditLog) Record(ctx context.Context, event domain.AuditEvent, err error) {
+	if event.ActorID == "" {
+		event.ActorID = domain.ActorFromContext(ctx)
+	}
+	if event.IP == "" && event.UserAgent == "" {
+		client := domain.ClientInfoFromContext(ctx)
+		event.IP, event.UserAgent = client.IP, client.UserAgent
+	}
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]any)
+	}
+
+	event.Outcome = domain.AuditSuccess
+	if err != nil {
+		event.Outcome = domain.AuditFailure
+		event.Metadata["error"] = err.Error()
+	}
+
+	if err := a.repository.Append(event); err != nil {
+		log.Printf("failed to write audit event %s for user %s: %s", event.Action, event.TargetID, err.Error())
+	}
+}
+
+func (a *AuditLog) List(filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	filter.Limit = min(filter.Limit, maxAuditPageSize)
+
+	return a.repository.List(filter)
+}
+
+// Export streams every matching event, the limit of the filter is ignored.
+func (a *AuditLog) Export(filter domain.AuditFilter, fn func(domain.AuditEvent) error) error {
+	filter.Limit = 0
+	return a.repository.Each(filter, fn)
+}
@@ -4,96 +4,432 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/jwks"
+	"log"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type AuthRepository interface {
-	CreateUser(user domain.User) error
-	GetByCredentials(email string, hashedPassword string) (domain.User, error)
+	CreateUser(user domain.User) (string, error)
+	GetByEmail(email string) (domain.User, error)
+	GetById(id string) (domain.User, error)
+	GetIdByAuthId(authId int64) (string, error)
+	GetAuthId(id string) (int64, error)
+	UpdatePassword(id string, passwordHash string) error
+	ResetPassword(tokenHash string, passwordHash string) error
+	MarkEmailVerified(id string) error
+}
+
+type ActionTokensRepository interface {
+	Create(token domain.ActionToken) error
+	Get(tokenHash string, purpose string) (domain.ActionToken, error)
+	Consume(tokenHash string, purpose string) (domain.ActionToken, error)
+	Invalidate(userId string, purpose string) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
 }
 
 type SessionsRepository interface {
-	Create(token domain.RefreshSession) error
-	Get(token string) (domain.RefreshSession, error)
+	Create(token domain.RefreshSession) (string, error)
+	GetByToken(tokenHash string) (domain.RefreshSession, error)
+	Rotate(tokenHash string, next domain.RefreshSession) (domain.RefreshSession, error)
+	RevokeFamily(familyId string) error
+	RevokeUserFamily(userId string, familyId string) error
+	RevokeAll(userId string) error
+	ListActive(userId string) ([]domain.Session, error)
 }
 
+// GrpcClient issues and validates access tokens. Refresh tokens are managed by AuthService itself.
 type GrpcClient interface {
 	ParseToken(ctx context.Context, token string) (int64, error)
 	GenerateToken(ctx context.Context, userId int64) (string, string, error)
-	RefreshToken(ctx context.Context, token string) (string, string, error)
+}
+
+// TokenVerifier validates access tokens in-process and returns their subject, the auth service's user id.
+type TokenVerifier interface {
+	Subject(ctx context.Context, token string) (string, error)
+}
+
+type AuthConfig struct {
+	RefreshTokenTTL time.Duration
+
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	// VerifyEmailURL is the frontend page the verification link points to; the token is appended as ?token=
+	VerifyEmailURL string
+
+	PasswordResetTTL time.Duration
+	// ResetPasswordURL is the frontend page the password reset link points to
+	ResetPasswordURL string
+
+	Lockout LockoutPolicy
+
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	// OIDCStateTTL is how long a login at an identity provider may take
+	OIDCStateTTL time.Duration
 }
 
 type AuthService struct {
 	repository         AuthRepository
 	sessionsRepository SessionsRepository
+	actionTokens       ActionTokensRepository
+	loginAttempts      LoginAttemptsRepository
+	mfa                MFARepository
+	identities         ExternalIdentitiesRepository
+	oidcProviders      map[string]OIDCProvider
 	hasher             PasswordHasher
 	grpcClient         GrpcClient
+	verifier           TokenVerifier
+	mailer             Mailer
+	audit              *AuditLog
+	config             AuthConfig
+	// dummyHash is checked against when the email is unknown, so such sign-ins take as long as wrong passwords
+	dummyHash func() string
 }
 
-func NewAuthService(repository AuthRepository, sessionsRepository SessionsRepository, hasher PasswordHasher, grpcClient GrpcClient) *AuthService {
+// NewAuthService creates the service. verifier may be nil, then every access token is checked by the auth service.
+// oidcProviders are keyed by the name used in the login URLs.
+func NewAuthService(repository AuthRepository, sessionsRepository SessionsRepository, actionTokens ActionTokensRepository,
+	loginAttempts LoginAttemptsRepository, mfa MFARepository, identities ExternalIdentitiesRepository, oidcProviders map[string]OIDCProvider,
+	hasher PasswordHasher, grpcClient GrpcClient, verifier TokenVerifier, mailer Mailer, audit *AuditLog, config AuthConfig) *AuthService {
 	return &AuthService{
 		repository:         repository,
 		sessionsRepository: sessionsRepository,
+		actionTokens:       actionTokens,
+		loginAttempts:      loginAttempts,
+		mfa:                mfa,
+		identities:         identities,
+		oidcProviders:      oidcProviders,
 		hasher:             hasher,
 		grpcClient:         grpcClient,
+		verifier:           verifier,
+		mailer:             mailer,
+		audit:              audit,
+		config:             config,
+		dummyHash: sync.OnceValue(func() string {
+			passwordHash, err := hasher.Hash("not a password")
+			if err != nil {
+				log.Printf("failed to hash the dummy password: %s", err.Error())
+			}
+			return passwordHash
+		}),
 	}
 }
 
-func (s *AuthService) SignUp(input domain.UserInput) error {
+func (s *AuthService) SignUp(ctx context.Context, input domain.UserInput) error {
 
 	password, err := s.hasher.Hash(*input.Password)
 	if err != nil {
 		return err
 	}
+	role := domain.RoleBuyer
+	if input.Role != nil {
+		role = *input.Role
+	}
+	if role == domain.RoleAdmin {
+		return domain.ErrForbidden
+	}
+
 	user := domain.User{
-		Name:     *input.Name,
-		Email:    *input.Email,
-		Password: password,
+		Username:  *input.Username,
+		Email:     *input.Email,
+		Password:  password,
+		Role:      role,
+		AvatarURL: input.AvatarURL,
+		Bio:       input.Bio,
 	}
-	err = s.repository.CreateUser(user)
-	return err
+	user.ID, err = s.repository.CreateUser(user)
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:   domain.AuditSignUp,
+		TargetID: user.ID,
+		Metadata: map[string]any{"email": user.Email, "role": user.Role},
+	}, err)
+	if err != nil {
+		return err
+	}
+
+	// the account exists at this point, a lost email can be requested again
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		log.Printf("failed to send verification email to user %s: %s", user.ID, err.Error())
+	}
+
+	return nil
 }
 
-func (s *AuthService) SignIn(ctx context.Context, signInInput domain.SignInInput) (string, string, error) {
-	password, err := s.hasher.Hash(signInInput.Password)
-	if err != nil {
-		return "", "", err
+func (s *AuthService) SignIn(ctx context.Context, signInInput domain.SignInInput, client domain.ClientInfo) (domain.SignInResult, error) {
+	user, result, err := s.signIn(ctx, signInInput, client)
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:    domain.AuditSignIn,
+		TargetID:  user.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Metadata:  map[string]any{"email": signInInput.Email, "mfa_required": result.MFAToken != ""},
+	}, err)
+
+	return result, err
+}
+
+// signIn also returns the user, as far as it got to know them, for the audit log.
+func (s *AuthService) signIn(ctx context.Context, signInInput domain.SignInInput, client domain.ClientInfo) (domain.User, domain.SignInResult, error) {
+	if err := s.checkLockout(signInInput.Email, client); err != nil {
+		return domain.User{}, domain.SignInResult{}, err
 	}
-	user, err := s.repository.GetByCredentials(signInInput.Email, password)
+
+	user, err := s.repository.GetByEmail(signInInput.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", "", domain.ErrUserNotFound
+			s.hasher.Verify(signInInput.Password, s.dummyHash())
+			s.registerFailedSignIn(signInInput.Email, client)
+			return domain.User{}, domain.SignInResult{}, domain.ErrInvalidCredentials
 		}
-		return "", "", err
+		return domain.User{}, domain.SignInResult{}, err
 	}
 
-	return s.GenerateToken(ctx, user.ID)
+	ok, err := s.hasher.Verify(signInInput.Password, user.Password)
+	if err != nil {
+		return user, domain.SignInResult{}, err
+	}
+	if !ok {
+		s.registerFailedSignIn(signInInput.Email, client)
+		return user, domain.SignInResult{}, domain.ErrInvalidCredentials
+	}
+
+	if err := s.loginAttempts.Reset(domain.LockoutScopeAccount, accountLockoutKey(signInInput.Email)); err != nil {
+		log.Printf("failed to reset sign-in failures for user %s: %s", user.ID, err.Error())
+	}
+
+	if s.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return user, domain.SignInResult{}, domain.ErrEmailNotVerified
+	}
+
+	if s.hasher.NeedsRehash(user.Password) {
+		s.rehashPassword(user.ID, signInInput.Password)
+	}
+
+	result, err := s.completeSignIn(ctx, user, client)
+	return user, result, err
+}
+
+// completeSignIn starts a session for a user who proved the first factor, or asks for the second one.
+func (s *AuthService) completeSignIn(ctx context.Context, user domain.User, client domain.ClientInfo) (domain.SignInResult, error) {
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := s.issueActionToken(user.ID, domain.PurposeMFAChallenge, s.config.MFAChallengeTTL)
+		if err != nil {
+			return domain.SignInResult{}, err
+		}
+		return domain.SignInResult{MFAToken: mfaToken}, nil
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+// rehashPassword upgrades a stored hash to the current algorithm. Failures are not fatal for sign-in.
+func (s *AuthService) rehashPassword(userId string, password string) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Printf("failed to rehash password for user %s: %s", userId, err.Error())
+		return
+	}
+
+	if err := s.repository.UpdatePassword(userId, passwordHash); err != nil {
+		log.Printf("failed to store rehashed password for user %s: %s", userId, err.Error())
+	}
 }
 
-func (s *AuthService) GenerateToken(ctx context.Context, userId int64) (string, string, error) {
-	accessToken, refreshToken, err := s.grpcClient.GenerateToken(ctx, userId)
+// startSession issues an access token and the first refresh token of a new family.
+func (s *AuthService) startSession(ctx context.Context, user domain.User, client domain.ClientInfo) (domain.SignInResult, error) {
+	accessToken, err := s.GenerateToken(ctx, user.AuthID)
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	refreshToken, err := newOpaqueToken()
 	if err != nil {
-		return "", "", fmt.Errorf(err.Error())
+		return domain.SignInResult{}, err
 	}
 
-	return accessToken, refreshToken, nil
+	sessionId, err := s.sessionsRepository.Create(domain.RefreshSession{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		Client:    client,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	})
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	return domain.SignInResult{AccessToken: accessToken, RefreshToken: refreshToken, SessionID: sessionId}, nil
 }
 
-func (s *AuthService) ParseToken(ctx context.Context, token string) (int64, error) {
-	id, err := s.grpcClient.ParseToken(ctx, token)
+func (s *AuthService) GenerateToken(ctx context.Context, authId int64) (string, error) {
+	accessToken, _, err := s.grpcClient.GenerateToken(ctx, authId)
 	if err != nil {
-		return 0, fmt.Errorf(err.Error())
+		return "", errors.New(err.Error())
+	}
+
+	return accessToken, nil
+}
+
+// ParseToken validates the access token and maps the auth service's numeric id onto the user's UUID.
+func (s *AuthService) ParseToken(ctx context.Context, token string) (string, error) {
+	authId, err := s.parseAuthId(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := s.repository.GetIdByAuthId(authId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrUserNotFound
+		}
+		return "", err
 	}
 
 	return id, nil
 }
 
-func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (string, string, error) {
-	accessToken, refreshToken, err := s.grpcClient.RefreshToken(ctx, refreshToken)
+// parseAuthId verifies the token locally when possible. The auth service is asked only when
+// there is no verifier, the token is signed with a key the verifier doesn't know or the key set is unreachable.
+func (s *AuthService) parseAuthId(ctx context.Context, token string) (int64, error) {
+	if s.verifier != nil {
+		subject, err := s.verifier.Subject(ctx, token)
+		if err == nil {
+			return strconv.ParseInt(subject, 10, 64)
+		}
+		if !errors.Is(err, jwks.ErrUnknownKey) && !errors.Is(err, jwks.ErrKeySetUnavailable) {
+			return 0, err
+		}
+	}
+
+	authId, err := s.grpcClient.ParseToken(ctx, token)
+	if err != nil {
+		return 0, errors.New(err.Error())
+	}
+
+	return authId, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new pair. Every refresh token is single-use:
+// presenting one that was already exchanged means it leaked, so the whole family is revoked.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.SignInResult, error) {
+	tokenHash := hashToken(refreshToken)
+
+	session, err := s.sessionsRepository.GetByToken(tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.SignInResult{}, domain.ErrInvalidRefreshToken
+		}
+		return domain.SignInResult{}, err
+	}
+
+	authId, err := s.repository.GetAuthId(session.UserID)
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	accessToken, err := s.GenerateToken(ctx, authId)
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	newRefreshToken, err := newOpaqueToken()
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	session, err = s.sessionsRepository.Rotate(tokenHash, domain.RefreshSession{
+		TokenHash: hashToken(newRefreshToken),
+		Client:    client,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	})
+	s.audit.Record(ctx, domain.AuditEvent{
+		ActorID:   session.UserID,
+		Action:    domain.AuditRefresh,
+		TargetID:  session.UserID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Metadata:  map[string]any{"session_id": session.FamilyID, "reuse_detected": errors.Is(err, domain.ErrRefreshTokenReused)},
+	}, err)
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			log.Printf("security: refresh token reuse detected for user %s, session family %s revoked",
+				session.UserID, session.FamilyID)
+		}
+		return domain.SignInResult{}, err
+	}
+
+	return domain.SignInResult{AccessToken: accessToken, RefreshToken: newRefreshToken, SessionID: session.FamilyID}, nil
+}
+
+// Logout revokes the session the refresh token belongs to. Unknown tokens are ignored.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	session, err := s.sessionsRepository.GetByToken(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	err = s.sessionsRepository.RevokeFamily(session.FamilyID)
+	s.recordLogout(ctx, session.UserID, session.FamilyID, err)
+
+	return err
+}
+
+// EndSession revokes one of the user's own sessions, sessions of other users are domain.ErrSessionNotFound.
+func (s *AuthService) EndSession(ctx context.Context, userId string, sessionId string) error {
+	err := s.sessionsRepository.RevokeUserFamily(userId, sessionId)
+	s.recordLogout(ctx, userId, sessionId, err)
+
+	return err
+}
+
+func (s *AuthService) recordLogout(ctx context.Context, userId string, sessionId string, err error) {
+	s.audit.Record(ctx, domain.AuditEvent{
+		ActorID:  userId,
+		Action:   domain.AuditLogout,
+		TargetID: userId,
+		Metadata: map[string]any{"session_id": sessionId},
+	}, err)
+}
+
+func (s *AuthService) LogoutAll(ctx context.Context, userId string) error {
+	err := s.sessionsRepository.RevokeAll(userId)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditLogoutAll, TargetID: userId}, err)
+
+	return err
+}
+
+// ListSessions returns the user's active sessions, marking the one with currentSessionId as current.
+func (s *AuthService) ListSessions(userId string, currentSessionId string) ([]domain.Session, error) {
+	sessions, err := s.sessionsRepository.ListActive(userId)
 	if err != nil {
-		return "", "", fmt.Errorf(err.Error())
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = currentSessionId != "" && sessions[i].ID == currentSessionId
 	}
 
-	return accessToken, refreshToken, err
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userId string, sessionId string) error {
+	err := s.sessionsRepository.RevokeUserFamily(userId, sessionId)
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:   domain.AuditSessionRevoked,
+		TargetID: userId,
+		Metadata: map[string]any{"session_id": sessionId},
+	}, err)
+
+	return err
 }
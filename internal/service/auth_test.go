@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	hash "github.com/dankru/Commissions_simple/pkg/hasher"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+// signInRepository knows one user by email and records the password hashes stored for them.
+type signInRepository struct {
+	AuthRepository
+	user   domain.User
+	stored []string
+}
+
+func (r *signInRepository) GetByEmail(email string) (domain.User, error) {
+	if email != r.user.Email {
+		return domain.User{}, sql.ErrNoRows
+	}
+	return r.user, nil
+}
+
+func (r *signInRepository) UpdatePassword(_ string, passwordHash string) error {
+	r.stored = append(r.stored, passwordHash)
+	return nil
+}
+
+type noLockouts struct {
+	LoginAttemptsRepository
+}
+
+func (noLockouts) LockedUntil(string, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (noLockouts) RegisterFailure(string, string, time.Duration) (int, error) {
+	return 1, nil
+}
+
+func (noLockouts) Reset(string, string) error {
+	return nil
+}
+
+// discardActionTokens accepts the MFA challenges of users with TOTP, so sign-in stops before starting a session.
+type discardActionTokens struct {
+	ActionTokensRepository
+}
+
+func (discardActionTokens) Invalidate(string, string) error {
+	return nil
+}
+
+func (discardActionTokens) Create(domain.ActionToken) error {
+	return nil
+}
+
+type discardAudit struct {
+	AuditRepository
+}
+
+func (discardAudit) Append(domain.AuditEvent) error {
+	return nil
+}
+
+// recordingHasher records the hashes passwords were verified against.
+type recordingHasher struct {
+	PasswordHasher
+	verified []string
+}
+
+func (h *recordingHasher) Verify(password, encoded string) (bool, error) {
+	h.verified = append(h.verified, encoded)
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func newSignInService(repo *signInRepository, hasher PasswordHasher) *AuthService {
+	return NewAuthService(repo, nil, discardActionTokens{}, noLockouts{}, nil, nil, nil, hasher, nil, nil, nil,
+		NewAuditLog(discardAudit{}), AuthConfig{})
+}
+
+func TestSignInRehashesLegacyPasswords(t *testing.T) {
+	current := hash.NewBcryptHasher(bcrypt.MinCost)
+	legacy := hash.NewSHA1Hasher("salt")
+	hasher := hash.NewPasswordHasher(current, legacy)
+
+	legacyHash, err := legacy.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentHash, err := current.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		err      error
+		rehashed bool
+	}{
+		{"legacy hash", legacyHash, "secret123", nil, true},
+		{"legacy hash with a wrong password", legacyHash, "secret124", domain.ErrInvalidCredentials, false},
+		{"current hash", currentHash, "secret123", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			repo := &signInRepository{user: domain.User{ID: "user", Email: "someone@example.com", Password: tt.stored, TOTPEnabledAt: &now}}
+
+			_, err := newSignInService(repo, hasher).SignIn(context.Background(),
+				domain.SignInInput{Email: "someone@example.com", Password: tt.password}, domain.ClientInfo{IP: "192.0.2.1"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if rehashed := len(repo.stored) > 0; rehashed != tt.rehashed {
+				t.Fatalf("rehashed = %t, want %t", rehashed, tt.rehashed)
+			}
+			if tt.rehashed {
+				if !current.Identify(repo.stored[0]) {
+					t.Errorf("stored %s, want a hash of the current algorithm", repo.stored[0])
+				}
+				if ok, _ := hasher.Verify(tt.password, repo.stored[0]); !ok {
+					t.Error("rehashed password doesn't verify")
+				}
+			}
+		})
+	}
+}
+
+func TestSignInWithUnknownEmailVerifiesDummyHash(t *testing.T) {
+	hasher := &recordingHasher{PasswordHasher: hash.NewPasswordHasher(hash.NewBcryptHasher(bcrypt.MinCost))}
+	repo := &signInRepository{user: domain.User{Email: "someone@example.com"}}
+
+	_, err := newSignInService(repo, hasher).SignIn(context.Background(),
+		domain.SignInInput{Email: "nobody@example.com", Password: "secret123"}, domain.ClientInfo{IP: "192.0.2.1"})
+	if !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+
+	if len(hasher.verified) != 1 || hasher.verified[0] == "" {
+		t.Errorf("verified against %q, want one dummy hash", hasher.verified)
+	}
+}
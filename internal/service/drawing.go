@@ -0,0 +1,425 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/storage"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDrawingsPageSize = 50
+	maxDrawingsPageSize     = 200
+)
+
+// drawingTypes maps the accepted content types, sniffed from the file itself, to file extensions.
+var drawingTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type DrawingsRepository interface {
+	Create(drawing domain.Drawing) (domain.Drawing, error)
+	GetById(id string) (domain.Drawing, error)
+	List(filter domain.DrawingFilter) ([]domain.Drawing, error)
+	Update(id string, input domain.DrawingUpdateInput) (domain.Drawing, error)
+	Delete(id string) error
+	RotateShareVersion(id string) (int, error)
+	TagsOf(ids []string) (map[string][]string, error)
+	ListByProvider(provider string, afterId string, limit int) ([]domain.Drawing, error)
+	ChangeStorageProvider(id string, from string, to string) error
+}
+
+// BlobStore keeps the drawing files of one storage provider.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet fails with storage.ErrPresignNotSupported when files can only be served through the API
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+type DrawingService struct {
+	repository DrawingsRepository
+	// stores are keyed by the storage_provider of the drawings they keep
+	stores      map[string]BlobStore
+	uploadTo    string
+	maxFileSize int64
+	presignTTL  time.Duration
+	shareSecret []byte
+}
+
+// NewDrawingService stores new uploads with the uploadTo provider, older drawings are read
+// from the provider they were stored with. shareSecret signs the share links.
+func NewDrawingService(repository DrawingsRepository, stores map[string]BlobStore, uploadTo string,
+	maxFileSize int64, presignTTL time.Duration, shareSecret []byte) *DrawingService {
+	return &DrawingService{
+		repository:  repository,
+		stores:      stores,
+		uploadTo:    uploadTo,
+		maxFileSize: maxFileSize,
+		presignTTL:  presignTTL,
+		shareSecret: shareSecret,
+	}
+}
+
+func (s *DrawingService) store(provider string) (BlobStore, error) {
+	store, ok := s.stores[provider]
+	if !ok {
+		return nil, fmt.Errorf("storage provider %s is not configured", provider)
+	}
+	return store, nil
+}
+
+func (s *DrawingService) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// Upload stores the file and creates the drawing. The content type is sniffed from the first bytes
+// of the file, whatever the client claims.
+func (s *DrawingService) Upload(ctx context.Context, artistId string, input domain.DrawingInput, file io.Reader) (domain.Drawing, error) {
+	buffered := bufio.NewReaderSize(file, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return domain.Drawing{}, err
+	}
+	if len(head) == 0 {
+		return domain.Drawing{}, domain.ErrUnsupportedMediaType
+	}
+
+	contentType := http.DetectContentType(head)
+	ext, ok := drawingTypes[contentType]
+	if !ok {
+		return domain.Drawing{}, domain.ErrUnsupportedMediaType
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return domain.Drawing{}, err
+	}
+	key := artistId + "/" + hex.EncodeToString(name) + ext
+
+	store, err := s.store(s.uploadTo)
+	if err != nil {
+		return domain.Drawing{}, err
+	}
+
+	// one byte over the limit is enough to tell the file is too large
+	size, err := store.Put(ctx, key, io.LimitReader(buffered, s.maxFileSize+1), contentType)
+	if err != nil {
+		return domain.Drawing{}, err
+	}
+	if size > s.maxFileSize {
+		s.deleteFile(ctx, s.uploadTo, key)
+		return domain.Drawing{}, domain.ErrFileTooLarge
+	}
+
+	visibility := input.Visibility
+	if visibility == "" {
+		visibility = domain.VisibilityPrivate
+	}
+
+	drawing, err := s.repository.Create(domain.Drawing{
+		ArtistID:        artistId,
+		Title:           input.Title,
+		Description:     input.Description,
+		FilePath:        key,
+		StorageProvider: s.uploadTo,
+		Visibility:      visibility,
+		ContentType:     contentType,
+		Size:            size,
+	})
+	if err != nil {
+		s.deleteFile(ctx, s.uploadTo, key)
+		return domain.Drawing{}, err
+	}
+	drawing.Tags = []string{}
+
+	return drawing, nil
+}
+
+func (s *DrawingService) Get(id string) (domain.Drawing, error) {
+	drawing, err := s.repository.GetById(id)
+	if err != nil {
+		return drawing, err
+	}
+
+	drawings, err := s.withTags([]domain.Drawing{drawing})
+	if err != nil {
+		return drawing, err
+	}
+	return drawings[0], nil
+}
+
+// View returns the drawing if the viewer may see it: public drawings are seen by everyone, drawings
+// with link visibility by holders of a valid share token and the rest only by their artist.
+// viewerId is empty for anonymous viewers. Drawings the viewer may not see are reported as not found.
+func (s *DrawingService) View(viewerId string, id string, shareToken string) (domain.Drawing, error) {
+	drawing, err := s.view(viewerId, id, shareToken)
+	if err != nil {
+		return drawing, err
+	}
+
+	drawings, err := s.withTags([]domain.Drawing{drawing})
+	if err != nil {
+		return drawing, err
+	}
+	return drawings[0], nil
+}
+
+func (s *DrawingService) view(viewerId string, id string, shareToken string) (domain.Drawing, error) {
+	drawing, err := s.repository.GetById(id)
+	if err != nil {
+		return drawing, err
+	}
+
+	if !s.canView(drawing, viewerId, shareToken) {
+		return domain.Drawing{}, domain.ErrDrawingNotFound
+	}
+
+	return drawing, nil
+}
+
+func (s *DrawingService) canView(drawing domain.Drawing, viewerId string, shareToken string) bool {
+	if viewerId != "" && viewerId == drawing.ArtistID {
+		return true
+	}
+
+	switch drawing.Visibility {
+	case domain.VisibilityPublic:
+		return true
+	case domain.VisibilityLink:
+		return shareToken != "" && s.verifyShareToken(drawing, shareToken)
+	default:
+		return false
+	}
+}
+
+// ShareLink returns a token that lets anyone view the drawing until expiresAt, or until the links
+// are rotated when expiresAt is nil. Only drawings with link visibility can be shared.
+func (s *DrawingService) ShareLink(id string, expiresAt *time.Time) (string, error) {
+	drawing, err := s.repository.GetById(id)
+	if err != nil {
+		return "", err
+	}
+
+	if drawing.Visibility != domain.VisibilityLink {
+		return "", domain.ErrDrawingNotShareable
+	}
+
+	var expires int64
+	if expiresAt != nil {
+		expires = expiresAt.Unix()
+	}
+
+	return s.signShareToken(drawing, expires), nil
+}
+
+// RotateShareLinks invalidates every share link of the drawing given out so far.
+func (s *DrawingService) RotateShareLinks(id string) error {
+	_, err := s.repository.RotateShareVersion(id)
+	return err
+}
+
+// Open returns the drawing with its file if the viewer may see it, see View. The caller closes the file.
+func (s *DrawingService) Open(ctx context.Context, viewerId string, id string, shareToken string) (domain.Drawing, io.ReadCloser, error) {
+	drawing, err := s.view(viewerId, id, shareToken)
+	if err != nil {
+		return drawing, nil, err
+	}
+
+	store, err := s.store(drawing.StorageProvider)
+	if err != nil {
+		return drawing, nil, err
+	}
+
+	file, err := store.Open(ctx, drawing.FilePath)
+	if err != nil {
+		return drawing, nil, err
+	}
+
+	return drawing, file, nil
+}
+
+// FileURL returns a short-lived URL the file can be downloaded from directly, or an empty URL
+// when its storage provider can't make one and the file has to be sent with Open. Access is checked like in View.
+func (s *DrawingService) FileURL(ctx context.Context, viewerId string, id string, shareToken string) (domain.Drawing, string, error) {
+	drawing, err := s.view(viewerId, id, shareToken)
+	if err != nil {
+		return drawing, "", err
+	}
+
+	store, err := s.store(drawing.StorageProvider)
+	if err != nil {
+		return drawing, "", err
+	}
+
+	url, err := store.PresignGet(ctx, drawing.FilePath, s.presignTTL)
+	if errors.Is(err, storage.ErrPresignNotSupported) {
+		return drawing, "", nil
+	}
+
+	return drawing, url, err
+}
+
+// List returns the drawings matching the filter, newest first. Only public drawings are listed,
+// and the viewer's own ones when filter.PublicOrOwnedBy is set.
+func (s *DrawingService) List(filter domain.DrawingFilter) ([]domain.Drawing, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultDrawingsPageSize
+	}
+	filter.Limit = min(filter.Limit, maxDrawingsPageSize)
+
+	tags, err := domain.NormalizeTags(filter.Tags)
+	if err != nil {
+		// no drawing can have an invalid tag
+		return []domain.Drawing{}, nil
+	}
+	filter.Tags = tags
+
+	drawings, err := s.repository.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withTags(drawings)
+}
+
+func (s *DrawingService) Update(id string, input domain.DrawingUpdateInput) (domain.Drawing, error) {
+	drawing, err := s.repository.Update(id, input)
+	if err != nil {
+		return drawing, err
+	}
+
+	drawings, err := s.withTags([]domain.Drawing{drawing})
+	if err != nil {
+		return drawing, err
+	}
+	return drawings[0], nil
+}
+
+func (s *DrawingService) withTags(drawings []domain.Drawing) ([]domain.Drawing, error) {
+	if len(drawings) == 0 {
+		return drawings, nil
+	}
+
+	ids := make([]string, 0, len(drawings))
+	for _, d := range drawings {
+		ids = append(ids, d.ID)
+	}
+
+	tags, err := s.repository.TagsOf(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range drawings {
+		drawings[i].Tags = tags[drawings[i].ID]
+		if drawings[i].Tags == nil {
+			drawings[i].Tags = []string{}
+		}
+	}
+
+	return drawings, nil
+}
+
+// Delete removes the drawing and then its file. A file that fails to be deleted is only logged,
+// nothing points to it anymore.
+func (s *DrawingService) Delete(ctx context.Context, id string) error {
+	drawing, err := s.repository.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(id); err != nil {
+		return err
+	}
+
+	s.deleteFile(ctx, drawing.StorageProvider, drawing.FilePath)
+	return nil
+}
+
+// MigrateBlobs moves the files of the drawings stored with one provider to another, batch by batch,
+// and returns how many were moved. It is safe to run while the service is serving: every drawing is
+// switched to the new provider only after its file is copied. Drawings that fail are logged and skipped.
+func (s *DrawingService) MigrateBlobs(ctx context.Context, from string, to string, batchSize int) (int, error) {
+	if from == to {
+		return 0, errors.New("source and destination providers are the same")
+	}
+
+	src, err := s.store(from)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := s.store(to)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	after := ""
+	for {
+		drawings, err := s.repository.ListByProvider(from, after, batchSize)
+		if err != nil {
+			return moved, err
+		}
+		if len(drawings) == 0 {
+			return moved, nil
+		}
+
+		for _, drawing := range drawings {
+			after = drawing.ID
+
+			if err := ctx.Err(); err != nil {
+				return moved, err
+			}
+
+			if err := s.moveBlob(ctx, drawing, src, dst, from, to); err != nil {
+				log.Printf("failed to move drawing %s from %s to %s: %s", drawing.ID, from, to, err.Error())
+				continue
+			}
+			moved++
+		}
+	}
+}
+
+func (s *DrawingService) moveBlob(ctx context.Context, drawing domain.Drawing, src, dst BlobStore, from, to string) error {
+	file, err := src.Open(ctx, drawing.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := dst.Put(ctx, drawing.FilePath, file, drawing.ContentType); err != nil {
+		return err
+	}
+
+	if err := s.repository.ChangeStorageProvider(drawing.ID, from, to); err != nil {
+		// the drawing still points to the source, or was deleted meanwhile
+		s.deleteFile(ctx, to, drawing.FilePath)
+		return err
+	}
+
+	s.deleteFile(ctx, from, drawing.FilePath)
+	return nil
+}
+
+func (s *DrawingService) deleteFile(ctx context.Context, provider string, key string) {
+	store, err := s.store(provider)
+	if err == nil {
+		err = store.Delete(ctx, key)
+	}
+	if err != nil {
+		log.Printf("failed to delete drawing file %s from %s: %s", key, provider, err.Error())
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/storage"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryBlobStore keeps files in a map.
+type memoryBlobStore struct {
+	files map[string]string
+}
+
+func (m *memoryBlobStore) Put(_ context.Context, key string, r io.Reader, _ string) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.files[key] = string(data)
+	return int64(len(data)), nil
+}
+
+func (m *memoryBlobStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := m.files[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (m *memoryBlobStore) Delete(_ context.Context, key string) error {
+	delete(m.files, key)
+	return nil
+}
+
+func (m *memoryBlobStore) PresignGet(context.Context, string, time.Duration) (string, error) {
+	return "", storage.ErrPresignNotSupported
+}
+
+// migrationRepository lists drawings by id like the postgres one. Changing the provider of failChange fails.
+type migrationRepository struct {
+	DrawingsRepository
+	drawings   map[string]*domain.Drawing
+	failChange string
+}
+
+func (r *migrationRepository) ListByProvider(provider string, afterId string, limit int) ([]domain.Drawing, error) {
+	ids := make([]string, 0, len(r.drawings))
+	for id := range r.drawings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	drawings := make([]domain.Drawing, 0, limit)
+	for _, id := range ids {
+		if id > afterId && r.drawings[id].StorageProvider == provider && len(drawings) < limit {
+			drawings = append(drawings, *r.drawings[id])
+		}
+	}
+	return drawings, nil
+}
+
+func (r *migrationRepository) ChangeStorageProvider(id string, from string, to string) error {
+	drawing, ok := r.drawings[id]
+	if !ok || drawing.StorageProvider != from {
+		return domain.ErrDrawingNotFound
+	}
+	if id == r.failChange {
+		return errors.New("connection reset")
+	}
+	drawing.StorageProvider = to
+	return nil
+}
+
+func TestMigrateBlobs(t *testing.T) {
+	local := &memoryBlobStore{files: map[string]string{}}
+	s3 := &memoryBlobStore{files: map[string]string{}}
+	repo := &migrationRepository{drawings: map[string]*domain.Drawing{}, failChange: "d3"}
+
+	for _, id := range []string{"d1", "d2", "d3", "d4", "d5"} {
+		repo.drawings[id] = &domain.Drawing{ID: id, FilePath: "artist/" + id + ".png", StorageProvider: "local"}
+		local.files["artist/"+id+".png"] = "image " + id
+	}
+	// d4 lost its file, it can't be moved
+	delete(local.files, "artist/d4.png")
+	// d6 is already in the destination
+	repo.drawings["d6"] = &domain.Drawing{ID: "d6", FilePath: "artist/d6.png", StorageProvider: "s3"}
+	s3.files["artist/d6.png"] = "image d6"
+
+	drawings := NewDrawingService(repo, map[string]BlobStore{"local": local, "s3": s3}, "local", 1<<20, time.Minute, nil)
+	moved, err := drawings.MigrateBlobs(context.Background(), "local", "s3", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 3 {
+		t.Errorf("moved = %d, want 3", moved)
+	}
+
+	for _, id := range []string{"d1", "d2", "d5", "d6"} {
+		key := "artist/" + id + ".png"
+		if repo.drawings[id].StorageProvider != "s3" || s3.files[key] != "image "+id {
+			t.Errorf("%s wasn't moved to s3", id)
+		}
+		if _, ok := local.files[key]; ok {
+			t.Errorf("%s is still stored locally", id)
+		}
+	}
+
+	// the copy of d3 is rolled back when the drawing can't be switched to the destination
+	if repo.drawings["d3"].StorageProvider != "local" || local.files["artist/d3.png"] != "image d3" {
+		t.Error("d3 should stay local")
+	}
+	if _, ok := s3.files["artist/d3.png"]; ok {
+		t.Error("the copy of d3 wasn't removed from s3")
+	}
+
+	if repo.drawings["d4"].StorageProvider != "local" {
+		t.Error("d4 without a file should stay local")
+	}
+}
+
+func TestMigrateBlobsRejectsUnknownProviders(t *testing.T) {
+	drawings := NewDrawingService(&migrationRepository{}, map[string]BlobStore{"local": &memoryBlobStore{}}, "local", 1<<20, time.Minute, nil)
+
+	if _, err := drawings.MigrateBlobs(context.Background(), "local", "local", 10); err == nil {
+		t.Error("expected an error for the same provider")
+	}
+	if _, err := drawings.MigrateBlobs(context.Background(), "local", "s3", 10); err == nil {
+		t.Error("expected an error for a provider that isn't configured")
+	}
+}
+
+// uploadRepository keeps the drawings that were created.
+type uploadRepository struct {
+	DrawingsRepository
+	created []domain.Drawing
+}
+
+func (r *uploadRepository) Create(drawing domain.Drawing) (domain.Drawing, error) {
+	r.created = append(r.created, drawing)
+	return drawing, nil
+}
+
+func TestUploadSniffsContentTypeAndLimitsSize(t *testing.T) {
+	const maxSize = 64
+	png := "\x89PNG\r\n\x1a\n"
+
+	tests := []struct {
+		name        string
+		file        string
+		err         error
+		contentType string
+	}{
+		{"png", png + "data", nil, "image/png"},
+		{"gif", "GIF89a" + "data", nil, "image/gif"},
+		{"at the limit", png + strings.Repeat("x", maxSize-len(png)), nil, "image/png"},
+		{"over the limit", png + strings.Repeat("x", maxSize-len(png)+1), domain.ErrFileTooLarge, ""},
+		{"text", "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>", domain.ErrUnsupportedMediaType, ""},
+		{"html", "<html><script>alert(1)</script></html>", domain.ErrUnsupportedMediaType, ""},
+		{"empty", "", domain.ErrUnsupportedMediaType, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryBlobStore{files: map[string]string{}}
+			repo := &uploadRepository{}
+			drawings := NewDrawingService(repo, map[string]BlobStore{"local": store}, "local", maxSize, time.Minute, nil)
+
+			drawing, err := drawings.Upload(context.Background(), "artist", domain.DrawingInput{Title: "title"}, strings.NewReader(tt.file))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				if len(repo.created) != 0 || len(store.files) != 0 {
+					t.Errorf("rejected upload left %d drawings and %d files", len(repo.created), len(store.files))
+				}
+				return
+			}
+
+			if drawing.ContentType != tt.contentType {
+				t.Errorf("content type = %s, want %s", drawing.ContentType, tt.contentType)
+			}
+			if drawing.Size != int64(len(tt.file)) || store.files[drawing.FilePath] != tt.file {
+				t.Errorf("stored %d bytes, want %d", len(store.files[drawing.FilePath]), len(tt.file))
+			}
+			if drawing.Visibility != domain.VisibilityPrivate {
+				t.Errorf("visibility = %s, want private by default", drawing.Visibility)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/url"
+	"time"
+)
+
+// issueActionToken invalidates the user's previous tokens for the purpose and stores a new one.
+func (s *AuthService) issueActionToken(userId string, purpose string, ttl time.Duration) (string, error) {
+	if err := s.actionTokens.Invalidate(userId, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.actionTokens.Create(domain.ActionToken{
+		TokenHash: hashToken(token),
+		UserID:    userId,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func linkWithToken(base string, token string) string {
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+func (s *AuthService) sendEmailVerification(ctx context.Context, user domain.User) error {
+	token, err := s.issueActionToken(user.ID, domain.PurposeEmailVerification, s.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+		user.Username, linkWithToken(s.config.VerifyEmailURL, token), s.config.EmailVerificationTTL)
+
+	return s.mailer.Send(ctx, user.Email, "Confirm your email", body)
+}
+
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	actionToken, err := s.actionTokens.Consume(hashToken(token), domain.PurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.MarkEmailVerified(actionToken.UserID)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditEmailVerified, TargetID: actionToken.UserID}, err)
+
+	return err
+}
+
+// ResendEmailVerification sends a new link. It succeeds silently for unknown and already verified
+// addresses, so it can't be used to find out who is registered.
+func (s *AuthService) ResendEmailVerification(ctx context.Context, email string) error {
+	user, err := s.repository.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
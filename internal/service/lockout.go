@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"log"
+	"strings"
+	"time"
+)
+
+type LoginAttemptsRepository interface {
+	LockedUntil(scope string, key string) (time.Time, error)
+	RegisterFailure(scope string, key string, window time.Duration) (int, error)
+	Lock(scope string, key string, until time.Time) error
+	Reset(scope string, key string) error
+}
+
+// LockoutPolicy configures sign-in throttling. Once a key reaches its threshold of failures in a row,
+// every further failure locks it for BaseDelay, doubling each time up to MaxDelay.
+type LockoutPolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+func (p LockoutPolicy) delay(failures int, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+func accountLockoutKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLockout returns a *domain.LockedError when either the account or the client is locked.
+func (s *AuthService) checkLockout(email string, client domain.ClientInfo) error {
+	var retryAfter time.Duration
+
+	for _, lock := range []struct{ scope, key string }{
+		{domain.LockoutScopeAccount, accountLockoutKey(email)},
+		{domain.LockoutScopeIP, client.IP},
+	} {
+		until, err := s.loginAttempts.LockedUntil(lock.scope, lock.key)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, time.Until(until))
+	}
+
+	if retryAfter > 0 {
+		return &domain.LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// registerFailedSignIn counts the failure against the account and the client and locks them when needed.
+// Failing to record it is logged rather than returned, the caller already reports invalid credentials.
+func (s *AuthService) registerFailedSignIn(email string, client domain.ClientInfo) {
+	policy := s.config.Lockout
+
+	for _, lock := range []struct {
+		scope, key string
+		threshold  int
+	}{
+		{domain.LockoutScopeAccount, accountLockoutKey(email), policy.AccountThreshold},
+		{domain.LockoutScopeIP, client.IP, policy.IPThreshold},
+	} {
+		failures, err := s.loginAttempts.RegisterFailure(lock.scope, lock.key, policy.Window)
+		if err != nil {
+			log.Printf("failed to register sign-in failure for %s %s: %s", lock.scope, lock.key, err.Error())
+			continue
+		}
+
+		if delay := policy.delay(failures, lock.threshold); delay > 0 {
+			if err := s.loginAttempts.Lock(lock.scope, lock.key, time.Now().Add(delay)); err != nil {
+				log.Printf("failed to lock %s %s: %s", lock.scope, lock.key, err.Error())
+			}
+		}
+	}
+}
+
+// UnlockAccount clears failed attempts and the lock of the user's account.
+func (s *AuthService) UnlockAccount(ctx context.Context, userId string) error {
+	user, err := s.repository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		return err
+	}
+
+	err = s.loginAttempts.Reset(domain.LockoutScopeAccount, accountLockoutKey(user.Email))
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditAccountUnlocked, TargetID: userId}, err)
+
+	return err
+}
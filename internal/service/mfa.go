@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/totp"
+	"log"
+	"strings"
+	"time"
+)
+
+type MFARepository interface {
+	GetTOTP(userId string) (domain.TOTP, error)
+	SetPendingSecret(userId string, secret string) error
+	Enable(userId string) error
+	UseStep(userId string, step int64) (bool, error)
+	ReplaceRecoveryCodes(userId string, codeHashes []string) error
+	UseRecoveryCode(userId string, codeHash string) (bool, error)
+	Reset(userId string) error
+}
+
+const (
+	recoveryCodesCount = 10
+	// recoveryCodeBytes makes 80 bit codes, written as 16 base32 characters
+	recoveryCodeBytes = 10
+	// totpSkew is how many steps before and after the current one are accepted
+	totpSkew = 1
+)
+
+// SignInMFA completes a sign-in that SignIn answered with an MFA token. Wrong codes count as failed
+// sign-ins, so the lockout applies to guessing codes too.
+func (s *AuthService) SignInMFA(ctx context.Context, input domain.MFASignInInput, client domain.ClientInfo) (domain.SignInResult, error) {
+	user, result, err := s.signInMFA(ctx, input, client)
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:    domain.AuditSignInMFA,
+		TargetID:  user.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}, err)
+
+	return result, err
+}
+
+func (s *AuthService) signInMFA(ctx context.Context, input domain.MFASignInInput, client domain.ClientInfo) (domain.User, domain.SignInResult, error) {
+	challengeHash := hashToken(input.MFAToken)
+
+	challenge, err := s.actionTokens.Get(challengeHash, domain.PurposeMFAChallenge)
+	if err != nil {
+		return domain.User{}, domain.SignInResult{}, err
+	}
+
+	user, err := s.repository.GetById(challenge.UserID)
+	if err != nil {
+		return domain.User{}, domain.SignInResult{}, err
+	}
+
+	if err := s.checkLockout(user.Email, client); err != nil {
+		return user, domain.SignInResult{}, err
+	}
+
+	if err := s.verifySecondFactor(user.ID, input.Code); err != nil {
+		if errors.Is(err, domain.ErrInvalidMFACode) {
+			s.registerFailedSignIn(user.Email, client)
+		}
+		return user, domain.SignInResult{}, err
+	}
+
+	if _, err := s.actionTokens.Consume(challengeHash, domain.PurposeMFAChallenge); err != nil {
+		return user, domain.SignInResult{}, err
+	}
+
+	if err := s.loginAttempts.Reset(domain.LockoutScopeAccount, accountLockoutKey(user.Email)); err != nil {
+		log.Printf("failed to reset sign-in failures for user %s: %s", user.ID, err.Error())
+	}
+
+	result, err := s.startSession(ctx, user, client)
+	return user, result, err
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *AuthService) verifySecondFactor(userId string, code string) error {
+	state, err := s.mfa.GetTOTP(userId)
+	if err != nil {
+		return err
+	}
+	if state.EnabledAt == nil {
+		return domain.ErrMFANotEnabled
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if len(code) == totp.Digits {
+		return s.useTOTPCode(userId, state.Secret, code)
+	}
+
+	return s.useRecoveryCode(userId, code)
+}
+
+// useRecoveryCode consumes the code. Codes are random enough to be stored like other tokens,
+// with hashToken, so the code is looked up by its hash instead of checked against every stored one.
+func (s *AuthService) useRecoveryCode(userId string, code string) error {
+	ok, err := s.mfa.UseRecoveryCode(userId, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// useTOTPCode validates the code and makes sure it can't be replayed.
+func (s *AuthService) useTOTPCode(userId string, secret string, code string) error {
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return domain.ErrInvalidMFACode
+	}
+
+	fresh, err := s.mfa.UseStep(userId, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// EnrollTOTP generates a new secret. 2FA is enabled only after ConfirmTOTP proves the app is set up.
+func (s *AuthService) EnrollTOTP(userId string) (domain.TOTPEnrollment, error) {
+	user, err := s.repository.GetById(userId)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	if err := s.mfa.SetPendingSecret(userId, secret); err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	return domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables 2FA and returns the recovery codes. They are shown only once.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userId string, code string) ([]string, error) {
+	state, err := s.mfa.GetTOTP(userId)
+	if err != nil {
+		return nil, err
+	}
+	if state.EnabledAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+	if state.Secret == "" {
+		return nil, domain.ErrMFAEnrollmentNeeded
+	}
+
+	if err := s.useTOTPCode(userId, state.Secret, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.Enable(userId); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditMFAEnabled, TargetID: userId}, nil)
+
+	return s.generateRecoveryCodes(userId)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, the old ones stop working.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userId string, code string) ([]string, error) {
+	if err := s.verifySecondFactor(userId, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.generateRecoveryCodes(userId)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditRecoveryCodesRenewed, TargetID: userId}, err)
+
+	return codes, err
+}
+
+func (s *AuthService) DisableTOTP(ctx context.Context, userId string, code string) error {
+	if err := s.verifySecondFactor(userId, code); err != nil {
+		return err
+	}
+
+	err := s.mfa.Reset(userId)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditMFADisabled, TargetID: userId}, err)
+
+	return err
+}
+
+// ResetMFA disables 2FA without a code, for admins helping users who lost their device.
+func (s *AuthService) ResetMFA(ctx context.Context, userId string) error {
+	err := s.mfa.Reset(userId)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditMFAReset, TargetID: userId}, err)
+
+	return err
+}
+
+func (s *AuthService) generateRecoveryCodes(userId string) ([]string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for range recoveryCodesCount {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	if err := s.mfa.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and dashes, so codes can be typed loosely.
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.ReplaceAll(code, "-", "")))
+}
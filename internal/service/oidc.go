@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/oidc"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ExternalIdentitiesRepository interface {
+	CreateState(state domain.OIDCState) error
+	ConsumeState(stateHash string, provider string) (domain.OIDCState, error)
+	GetUserId(provider string, subject string) (string, error)
+	Link(identity domain.ExternalIdentity) error
+	CreateUser(user domain.User, identity domain.ExternalIdentity) (string, error)
+	ListByUser(userId string) ([]domain.ExternalIdentity, error)
+}
+
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (oidc.Claims, error)
+}
+
+const usernameAttempts = 5
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func (s *AuthService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// StartOIDCLogin returns the provider URL to redirect the user to and the state of the login.
+// The caller should bind the state to the browser, e.g. with a cookie, and check it in the callback.
+func (s *AuthService) StartOIDCLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return "", "", domain.ErrUnknownProvider
+	}
+
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.identities.CreateState(domain.OIDCState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(s.config.OIDCStateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// FinishOIDCLogin signs in with the identity the provider returned. Unknown identities are linked to the user
+// with the same verified email, or a new user is created.
+func (s *AuthService) FinishOIDCLogin(ctx context.Context, providerName string, state string, code string, client domain.ClientInfo) (domain.SignInResult, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return domain.SignInResult{}, domain.ErrUnknownProvider
+	}
+
+	login, err := s.identities.ConsumeState(hashToken(state), providerName)
+	if err != nil {
+		return domain.SignInResult{}, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:    domain.AuditOIDCSignIn,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Metadata:  map[string]any{"provider": providerName},
+		}, err)
+		return domain.SignInResult{}, err
+	}
+
+	user, err := s.userForIdentity(ctx, providerName, claims)
+	if err != nil {
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:    domain.AuditOIDCSignIn,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Metadata:  map[string]any{"provider": providerName, "subject": claims.Subject, "email": claims.Email},
+		}, err)
+		return domain.SignInResult{}, err
+	}
+
+	result, err := s.completeSignIn(ctx, user, client)
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:    domain.AuditOIDCSignIn,
+		TargetID:  user.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Metadata:  map[string]any{"provider": providerName, "subject": claims.Subject, "mfa_required": result.MFAToken != ""},
+	}, err)
+
+	return result, err
+}
+
+func (s *AuthService) userForIdentity(ctx context.Context, providerName string, claims oidc.Claims) (domain.User, error) {
+	userId, err := s.identities.GetUserId(providerName, claims.Subject)
+	if err == nil {
+		return s.repository.GetById(userId)
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		return domain.User{}, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return domain.User{}, domain.ErrProviderEmailMissing
+	}
+
+	identity := domain.ExternalIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := s.repository.GetByEmail(claims.Email)
+	if err == nil {
+		if user.EmailVerifiedAt == nil {
+			return domain.User{}, domain.ErrIdentityLinkNotAllowed
+		}
+
+		identity.UserID = user.ID
+		err := s.identities.Link(identity)
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:   domain.AuditIdentityLinked,
+			TargetID: user.ID,
+			Metadata: map[string]any{"provider": providerName, "subject": claims.Subject},
+		}, err)
+		if err != nil {
+			return domain.User{}, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return domain.User{}, err
+	}
+
+	return s.createUserForIdentity(ctx, claims, identity)
+}
+
+// createUserForIdentity registers a user without a usable password; one can be set with the password reset.
+func (s *AuthService) createUserForIdentity(ctx context.Context, claims oidc.Claims, identity domain.ExternalIdentity) (domain.User, error) {
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return domain.User{}, err
+	}
+	password, err := s.hasher.Hash(secret)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user := domain.User{
+		Email:    claims.Email,
+		Password: password,
+		Role:     domain.RoleBuyer,
+	}
+
+	base := usernameFromClaims(claims)
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			suffix := make([]byte, 3)
+			if _, err := rand.Read(suffix); err != nil {
+				return domain.User{}, err
+			}
+			user.Username = base + "_" + hex.EncodeToString(suffix)
+		}
+
+		id, err := s.identities.CreateUser(user, identity)
+		if errors.Is(err, domain.ErrUsernameTaken) {
+			continue
+		}
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:   domain.AuditSignUp,
+			TargetID: id,
+			Metadata: map[string]any{"email": user.Email, "role": user.Role, "provider": identity.Provider},
+		}, err)
+		if err != nil {
+			return domain.User{}, err
+		}
+
+		return s.repository.GetById(id)
+	}
+
+	return domain.User{}, domain.ErrUsernameTaken
+}
+
+// usernameFromClaims leaves room for the suffix added when the name is taken.
+func usernameFromClaims(claims oidc.Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	name = usernameDisallowed.ReplaceAllString(name, "")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	if len(name) < 2 {
+		name = "user"
+	}
+
+	return name
+}
+
+func (s *AuthService) ListIdentities(userId string) ([]domain.ExternalIdentity, error) {
+	return s.identities.ListByUser(userId)
+}
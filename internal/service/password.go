@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"log"
+	"time"
+)
+
+// mailTimeout bounds the emails sent in the background, a stuck SMTP server must not keep goroutines forever.
+const mailTimeout = 30 * time.Second
+
+// ForgotPassword emails a password reset link. Everything happens in the background, so neither the response
+// nor its timing tells whether the address is registered. Failures are only logged.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+	go func() {
+		defer cancel()
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("failed to send password reset email: %s", err.Error())
+		}
+	}()
+}
+
+func (s *AuthService) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repository.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueActionToken(user.ID, domain.PurposePasswordReset, s.config.PasswordResetTTL)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditPasswordResetRequested, TargetID: user.ID}, err)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nsomebody asked to reset the password of your account. "+
+		"If it was you, open the link below to choose a new password:\n\n%s\n\n"+
+		"The link expires in %s. If you didn't ask for it, just ignore this email.\n",
+		user.Username, linkWithToken(s.config.ResetPasswordURL, token), s.config.PasswordResetTTL)
+
+	return s.mailer.Send(ctx, user.Email, "Reset your password", body)
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+// Following the emailed link also proves the address belongs to the user.
+func (s *AuthService) ResetPassword(ctx context.Context, token string, password string) error {
+	tokenHash := hashToken(token)
+
+	// check the token before hashing, the repository consumes it with the reset
+	actionToken, err := s.actionTokens.Get(tokenHash, domain.PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.ResetPassword(tokenHash, passwordHash)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditPasswordReset, TargetID: actionToken.UserID}, err)
+
+	return err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+)
+
+const (
+	defaultReviewsPageSize = 50
+	maxReviewsPageSize     = 200
+)
+
+type ReviewsRepository interface {
+	Create(review domain.Review) (domain.Review, error)
+	GetById(revieweeId string, id int64) (domain.Review, error)
+	ListByReviewee(revieweeId string, limit int, offset int) ([]domain.Review, error)
+	Update(review domain.Review) (domain.Review, error)
+	Delete(revieweeId string, id int64, reviewerId string) error
+	Summary(revieweeId string) (domain.RatingSummary, error)
+}
+
+type ReviewService struct {
+	repository ReviewsRepository
+	users      UserRepository
+}
+
+func NewReviewService(repository ReviewsRepository, users UserRepository) *ReviewService {
+	return &ReviewService{
+		repository: repository,
+		users:      users,
+	}
+}
+
+// Create adds the reviewer's review of the user. Every user can review another one once.
+func (s *ReviewService) Create(reviewerId string, revieweeId string, input domain.ReviewInput) (domain.Review, error) {
+	if reviewerId == revieweeId {
+		return domain.Review{}, domain.ErrSelfReview
+	}
+
+	if _, err := s.users.GetById(revieweeId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Review{}, domain.ErrUserNotFound
+		}
+		return domain.Review{}, err
+	}
+
+	return s.repository.Create(domain.Review{
+		ReviewerID: reviewerId,
+		RevieweeID: revieweeId,
+		Rating:     input.Rating,
+		Comment:    input.Comment,
+	})
+}
+
+func (s *ReviewService) Get(revieweeId string, id int64) (domain.Review, error) {
+	return s.repository.GetById(revieweeId, id)
+}
+
+// List returns the reviews of the user, newest first.
+func (s *ReviewService) List(revieweeId string, limit int, offset int) ([]domain.Review, error) {
+	if limit <= 0 {
+		limit = defaultReviewsPageSize
+	}
+	return s.repository.ListByReviewee(revieweeId, min(limit, maxReviewsPageSize), offset)
+}
+
+// Update changes the rating and the comment of the reviewer's own review.
+func (s *ReviewService) Update(reviewerId string, revieweeId string, id int64, input domain.ReviewInput) (domain.Review, error) {
+	review, err := s.repository.Update(domain.Review{
+		ID:         id,
+		ReviewerID: reviewerId,
+		RevieweeID: revieweeId,
+		Rating:     input.Rating,
+		Comment:    input.Comment,
+	})
+	if errors.Is(err, domain.ErrReviewNotFound) {
+		return review, s.notOwnedError(revieweeId, id)
+	}
+	return review, err
+}
+
+// Delete withdraws the reviewer's own review.
+func (s *ReviewService) Delete(reviewerId string, revieweeId string, id int64) error {
+	err := s.repository.Delete(revieweeId, id, reviewerId)
+	if errors.Is(err, domain.ErrReviewNotFound) {
+		return s.notOwnedError(revieweeId, id)
+	}
+	return err
+}
+
+// Remove deletes any review, it's meant for moderators.
+func (s *ReviewService) Remove(revieweeId string, id int64) error {
+	return s.repository.Delete(revieweeId, id, "")
+}
+
+// notOwnedError tells whether a review a write of its reviewer didn't match is missing or written by someone else.
+func (s *ReviewService) notOwnedError(revieweeId string, id int64) error {
+	if _, err := s.repository.GetById(revieweeId, id); err != nil {
+		return err
+	}
+	return domain.ErrForbidden
+}
+
+func (s *ReviewService) Summary(revieweeId string) (domain.RatingSummary, error) {
+	return s.repository.Summary(revieweeId)
+}
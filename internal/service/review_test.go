@@ -0,0 +1,202 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"testing"
+)
+
+const (
+	alice = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	bob   = "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"
+	carol = "cccccccc-cccc-cccc-cccc-cccccccccccc"
+)
+
+// memoryReviews matches reviews like the WHERE clauses of the postgres repository.
+type memoryReviews struct {
+	ReviewsRepository
+	reviews []domain.Review
+	nextId  int64
+}
+
+func (m *memoryReviews) Create(review domain.Review) (domain.Review, error) {
+	for _, r := range m.reviews {
+		if r.ReviewerID == review.ReviewerID && r.RevieweeID == review.RevieweeID {
+			return domain.Review{}, domain.ErrDuplicateReview
+		}
+	}
+	m.nextId++
+	review.ID = m.nextId
+	m.reviews = append(m.reviews, review)
+	return review, nil
+}
+
+func (m *memoryReviews) GetById(revieweeId string, id int64) (domain.Review, error) {
+	for _, r := range m.reviews {
+		if r.ID == id && r.RevieweeID == revieweeId {
+			return r, nil
+		}
+	}
+	return domain.Review{}, domain.ErrReviewNotFound
+}
+
+func (m *memoryReviews) Update(review domain.Review) (domain.Review, error) {
+	for i, r := range m.reviews {
+		if r.ID == review.ID && r.RevieweeID == review.RevieweeID && r.ReviewerID == review.ReviewerID {
+			m.reviews[i].Rating, m.reviews[i].Comment = review.Rating, review.Comment
+			return m.reviews[i], nil
+		}
+	}
+	return domain.Review{}, domain.ErrReviewNotFound
+}
+
+func (m *memoryReviews) Delete(revieweeId string, id int64, reviewerId string) error {
+	for i, r := range m.reviews {
+		if r.ID == id && r.RevieweeID == revieweeId && (reviewerId == "" || r.ReviewerID == reviewerId) {
+			m.reviews = append(m.reviews[:i], m.reviews[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrReviewNotFound
+}
+
+func (m *memoryReviews) Summary(revieweeId string) (domain.RatingSummary, error) {
+	counts := make(map[int]int)
+	for _, r := range m.reviews {
+		if r.RevieweeID == revieweeId {
+			counts[r.Rating]++
+		}
+	}
+	return domain.NewRatingSummary(counts), nil
+}
+
+// knownUsers finds alice, bob and carol.
+type knownUsers struct {
+	UserRepository
+}
+
+func (knownUsers) GetById(id string) (domain.User, error) {
+	switch id {
+	case alice, bob, carol:
+		return domain.User{ID: id}, nil
+	default:
+		return domain.User{}, sql.ErrNoRows
+	}
+}
+
+func TestCreateReview(t *testing.T) {
+	reviews := NewReviewService(&memoryReviews{}, knownUsers{})
+
+	if _, err := reviews.Create(bob, alice, domain.ReviewInput{Rating: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		reviewer string
+		reviewee string
+		err      error
+	}{
+		{"self review", alice, alice, domain.ErrSelfReview},
+		{"duplicate review", bob, alice, domain.ErrDuplicateReview},
+		{"unknown user", bob, "dddddddd-dddd-dddd-dddd-dddddddddddd", domain.ErrUserNotFound},
+		{"another reviewer", carol, alice, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := reviews.Create(tt.reviewer, tt.reviewee, domain.ReviewInput{Rating: 4}); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestChangeReviewOfAnotherReviewer(t *testing.T) {
+	repo := &memoryReviews{}
+	reviews := NewReviewService(repo, knownUsers{})
+
+	review, err := reviews.Create(bob, alice, domain.ReviewInput{Rating: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reviews.Update(carol, alice, review.ID, domain.ReviewInput{Rating: 1}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("update by another user = %v, want ErrForbidden", err)
+	}
+	if err := reviews.Delete(carol, alice, review.ID); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("delete by another user = %v, want ErrForbidden", err)
+	}
+	if _, err := reviews.Update(bob, carol, review.ID, domain.ReviewInput{Rating: 1}); !errors.Is(err, domain.ErrReviewNotFound) {
+		t.Errorf("update under another reviewee = %v, want ErrReviewNotFound", err)
+	}
+	if stored, _ := repo.GetById(alice, review.ID); stored.Rating != 2 {
+		t.Fatalf("rating = %d, the review was changed", stored.Rating)
+	}
+
+	updated, err := reviews.Update(bob, alice, review.ID, domain.ReviewInput{Rating: 4})
+	if err != nil || updated.Rating != 4 {
+		t.Fatalf("update by the reviewer = %+v, %v", updated, err)
+	}
+
+	if err := reviews.Delete(bob, alice, review.ID); err != nil {
+		t.Fatalf("delete by the reviewer = %v", err)
+	}
+	if err := reviews.Delete(bob, alice, review.ID); !errors.Is(err, domain.ErrReviewNotFound) {
+		t.Errorf("deleting again = %v, want ErrReviewNotFound", err)
+	}
+}
+
+func TestRemoveReview(t *testing.T) {
+	reviews := NewReviewService(&memoryReviews{}, knownUsers{})
+
+	review, err := reviews.Create(bob, alice, domain.ReviewInput{Rating: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reviews.Remove(alice, review.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reviews.Get(alice, review.ID); !errors.Is(err, domain.ErrReviewNotFound) {
+		t.Errorf("Get after remove = %v, want ErrReviewNotFound", err)
+	}
+}
+
+func TestRatingSummary(t *testing.T) {
+	reviews := NewReviewService(&memoryReviews{}, knownUsers{})
+
+	empty, err := reviews.Summary(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Count != 0 || empty.Average != 0 || len(empty.Histogram) != 5 {
+		t.Errorf("summary without reviews = %+v", empty)
+	}
+
+	for reviewer, rating := range map[string]int{bob: 5, carol: 2} {
+		if _, err := reviews.Create(reviewer, alice, domain.ReviewInput{Rating: rating}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reviews of other users don't count
+	if _, err := reviews.Create(alice, bob, domain.ReviewInput{Rating: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := reviews.Summary(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Count != 2 || summary.Average != 3.5 {
+		t.Errorf("count = %d, average = %v, want 2 and 3.5", summary.Count, summary.Average)
+	}
+	want := map[int]int{1: 0, 2: 1, 3: 0, 4: 0, 5: 1}
+	for rating, count := range want {
+		if summary.Histogram[rating] != count {
+			t.Errorf("histogram = %v, want %v", summary.Histogram, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Share tokens look like <expires>.<signature>, where expires is a unix time or 0 for links that don't expire.
+// The signature covers the drawing id and its share version, so a token opens only one drawing
+// and stops working when the artist rotates the links.
+
+func (s *DrawingService) signShareToken(drawing domain.Drawing, expires int64) string {
+	mac := hmac.New(sha256.New, s.shareSecret)
+	fmt.Fprintf(mac, "drawing-share:%s:%d:%d", drawing.ID, drawing.ShareVersion, expires)
+	return strconv.FormatInt(expires, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *DrawingService) verifyShareToken(drawing domain.Drawing, token string) bool {
+	expiresPart, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(expiresPart, 10, 64)
+	if err != nil || expires < 0 {
+		return false
+	}
+	if expires != 0 && time.Now().Unix() >= expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(token), []byte(s.signShareToken(drawing, expires)))
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const shareTestSecret = "0123456789abcdef0123456789abcdef"
+
+func TestShareToken(t *testing.T) {
+	drawings := NewDrawingService(nil, nil, "local", 1<<20, time.Minute, []byte(shareTestSecret))
+	drawing := domain.Drawing{ID: "d1", Visibility: domain.VisibilityLink, ShareVersion: 1}
+	later := time.Now().Add(time.Hour).Unix()
+
+	valid := drawings.signShareToken(drawing, later)
+	expires, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		drawing domain.Drawing
+		token   string
+		valid   bool
+	}{
+		{"valid", drawing, valid, true},
+		{"without expiry", drawing, drawings.signShareToken(drawing, 0), true},
+		{"expired", drawing, drawings.signShareToken(drawing, time.Now().Add(-time.Second).Unix()), false},
+		{"extended expiry", drawing, strconv.FormatInt(later+3600, 10) + "." + signature, false},
+		{"expiry removed", drawing, "0." + signature, false},
+		{"tampered signature", drawing, expires + "." + strings.Repeat("A", len(signature)), false},
+		{"negative expiry", drawing, drawings.signShareToken(drawing, -1), false},
+		{"another drawing", domain.Drawing{ID: "d2", ShareVersion: 1}, valid, false},
+		{"after rotation", domain.Drawing{ID: "d1", ShareVersion: 2}, valid, false},
+		{"other secret", drawing, NewDrawingService(nil, nil, "local", 1<<20, time.Minute, []byte(strings.ToUpper(shareTestSecret))).signShareToken(drawing, later), false},
+		{"no signature", drawing, expires, false},
+		{"empty", drawing, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := drawings.verifyShareToken(tt.drawing, tt.token); got != tt.valid {
+				t.Errorf("verifyShareToken(%q) = %t, want %t", tt.token, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCanView(t *testing.T) {
+	drawings := NewDrawingService(nil, nil, "local", 1<<20, time.Minute, []byte(shareTestSecret))
+
+	const artistId, otherId = "artist", "other"
+	public := domain.Drawing{ID: "public", ArtistID: artistId, Visibility: domain.VisibilityPublic}
+	link := domain.Drawing{ID: "link", ArtistID: artistId, Visibility: domain.VisibilityLink}
+	private := domain.Drawing{ID: "private", ArtistID: artistId, Visibility: domain.VisibilityPrivate}
+	linkToken := drawings.signShareToken(link, 0)
+
+	tests := []struct {
+		name    string
+		drawing domain.Drawing
+		viewer  string
+		token   string
+		allowed bool
+	}{
+		{"public by owner", public, artistId, "", true},
+		{"public by other user", public, otherId, "", true},
+		{"public anonymously", public, "", "", true},
+
+		{"link by owner", link, artistId, "", true},
+		{"link by other user", link, otherId, "", false},
+		{"link anonymously", link, "", "", false},
+		{"link by other user with token", link, otherId, linkToken, true},
+		{"link anonymously with token", link, "", linkToken, true},
+		{"link with token of another drawing", link, "", drawings.signShareToken(public, 0), false},
+
+		{"private by owner", private, artistId, "", true},
+		{"private by other user", private, otherId, "", false},
+		{"private anonymously", private, "", "", false},
+		{"private with a valid signature", private, "", drawings.signShareToken(private, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := drawings.canView(tt.drawing, tt.viewer, tt.token); got != tt.allowed {
+				t.Errorf("canView = %t, want %t", got, tt.allowed)
+			}
+		})
+	}
+}
+
+// shareRepository keeps one drawing and bumps its share version on rotation.
+type shareRepository struct {
+	DrawingsRepository
+	drawing domain.Drawing
+}
+
+func (r *shareRepository) GetById(id string) (domain.Drawing, error) {
+	if id != r.drawing.ID {
+		return domain.Drawing{}, domain.ErrDrawingNotFound
+	}
+	return r.drawing, nil
+}
+
+func (r *shareRepository) RotateShareVersion(id string) (int, error) {
+	if id != r.drawing.ID {
+		return 0, domain.ErrDrawingNotFound
+	}
+	r.drawing.ShareVersion++
+	return r.drawing.ShareVersion, nil
+}
+
+func TestRotateShareLinks(t *testing.T) {
+	repo := &shareRepository{drawing: domain.Drawing{ID: "d1", ArtistID: "artist", Visibility: domain.VisibilityLink}}
+	drawings := NewDrawingService(repo, nil, "local", 1<<20, time.Minute, []byte(shareTestSecret))
+
+	old, err := drawings.ShareLink("d1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drawings.view("", "d1", old); err != nil {
+		t.Fatalf("view with a fresh token = %v", err)
+	}
+
+	if err := drawings.RotateShareLinks("d1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drawings.view("", "d1", old); !errors.Is(err, domain.ErrDrawingNotFound) {
+		t.Errorf("view with a rotated token = %v, want ErrDrawingNotFound", err)
+	}
+
+	fresh, err := drawings.ShareLink("d1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drawings.view("", "d1", fresh); err != nil {
+		t.Errorf("view with a token made after rotation = %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"strings"
+)
+
+const (
+	defaultAutocompleteSize = 10
+	maxAutocompleteSize     = 50
+)
+
+type TagsRepository interface {
+	Attach(drawingId string, names []string) error
+	Detach(drawingId string, name string) error
+	Autocomplete(prefix string, limit int) ([]domain.Tag, error)
+	GetById(id int64) (domain.Tag, error)
+	Rename(id int64, name string) error
+	Merge(sourceId int64, targetId int64) error
+	AddAlias(id int64, alias string) error
+	RemoveAlias(id int64, alias string) error
+}
+
+// TagService manages the tags of drawings. Names are normalized with domain.NormalizeTag everywhere,
+// and an alias can be used wherever a tag name is expected.
+type TagService struct {
+	repository TagsRepository
+}
+
+func NewTagService(repository TagsRepository) *TagService {
+	return &TagService{repository: repository}
+}
+
+func (s *TagService) Attach(drawingId string, names []string) error {
+	tags, err := domain.NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	return s.repository.Attach(drawingId, tags)
+}
+
+func (s *TagService) Detach(drawingId string, name string) error {
+	tag, err := domain.NormalizeTag(name)
+	if err != nil {
+		return domain.ErrTagNotFound
+	}
+	return s.repository.Detach(drawingId, tag)
+}
+
+// Autocomplete suggests the tags starting with prefix that are used most on public drawings.
+func (s *TagService) Autocomplete(prefix string, limit int) ([]domain.Tag, error) {
+	if limit <= 0 {
+		limit = defaultAutocompleteSize
+	}
+
+	// a trailing space is part of what the user has typed so far
+	prefix = strings.TrimLeft(strings.ToLower(prefix), " ")
+	return s.repository.Autocomplete(prefix, min(limit, maxAutocompleteSize))
+}
+
+func (s *TagService) Get(id int64) (domain.Tag, error) {
+	return s.repository.GetById(id)
+}
+
+func (s *TagService) Rename(id int64, name string) error {
+	tag, err := domain.NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+	return s.repository.Rename(id, tag)
+}
+
+// Merge moves everything tagged with the source to the target tag and keeps the source's name as an alias.
+func (s *TagService) Merge(sourceId int64, targetId int64) error {
+	if sourceId == targetId {
+		return domain.ErrMergeSameTags
+	}
+	return s.repository.Merge(sourceId, targetId)
+}
+
+func (s *TagService) AddAlias(id int64, alias string) error {
+	name, err := domain.NormalizeTag(alias)
+	if err != nil {
+		return err
+	}
+	return s.repository.AddAlias(id, name)
+}
+
+func (s *TagService) RemoveAlias(id int64, alias string) error {
+	name, err := domain.NormalizeTag(alias)
+	if err != nil {
+		return domain.ErrTagNotFound
+	}
+	return s.repository.RemoveAlias(id, name)
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// memoryTags keeps tags, aliases and the tags of drawings and resolves names like the postgres repositories.
+type memoryTags struct {
+	TagsRepository
+	names    map[int64]string
+	aliases  map[string]int64
+	drawings map[string]map[int64]bool
+	nextId   int64
+}
+
+func newMemoryTags(drawingIds ...string) *memoryTags {
+	m := &memoryTags{names: map[int64]string{}, aliases: map[string]int64{}, drawings: map[string]map[int64]bool{}}
+	for _, id := range drawingIds {
+		m.drawings[id] = map[int64]bool{}
+	}
+	return m
+}
+
+func (m *memoryTags) resolve(name string) (int64, bool) {
+	for id, tagName := range m.names {
+		if tagName == name {
+			return id, true
+		}
+	}
+	id, ok := m.aliases[name]
+	return id, ok
+}
+
+func (m *memoryTags) taken(name string, exceptId int64) bool {
+	id, ok := m.resolve(name)
+	return ok && (id != exceptId || m.names[id] != name)
+}
+
+func (m *memoryTags) Attach(drawingId string, names []string) error {
+	for _, name := range names {
+		id, ok := m.resolve(name)
+		if !ok {
+			m.nextId++
+			id = m.nextId
+			m.names[id] = name
+		}
+		m.drawings[drawingId][id] = true
+	}
+	if len(m.drawings[drawingId]) > domain.MaxTagsPerDrawing {
+		return domain.ErrTooManyTags
+	}
+	return nil
+}
+
+func (m *memoryTags) Detach(drawingId string, name string) error {
+	id, ok := m.resolve(name)
+	if !ok || !m.drawings[drawingId][id] {
+		return domain.ErrTagNotFound
+	}
+	delete(m.drawings[drawingId], id)
+	return nil
+}
+
+func (m *memoryTags) GetById(id int64) (domain.Tag, error) {
+	name, ok := m.names[id]
+	if !ok {
+		return domain.Tag{}, domain.ErrTagNotFound
+	}
+	tag := domain.Tag{ID: id, Name: name, Aliases: []string{}}
+	for alias, tagId := range m.aliases {
+		if tagId == id {
+			tag.Aliases = append(tag.Aliases, alias)
+		}
+	}
+	sort.Strings(tag.Aliases)
+	return tag, nil
+}
+
+func (m *memoryTags) Rename(id int64, name string) error {
+	if m.aliases[name] == id {
+		delete(m.aliases, name)
+	}
+	if m.taken(name, id) {
+		return domain.ErrTagExists
+	}
+	if _, ok := m.names[id]; !ok {
+		return domain.ErrTagNotFound
+	}
+	m.names[id] = name
+	return nil
+}
+
+func (m *memoryTags) Merge(sourceId int64, targetId int64) error {
+	sourceName, ok := m.names[sourceId]
+	if _, targetOk := m.names[targetId]; !ok || !targetOk {
+		return domain.ErrTagNotFound
+	}
+	for _, tags := range m.drawings {
+		if tags[sourceId] {
+			delete(tags, sourceId)
+			tags[targetId] = true
+		}
+	}
+	for alias, id := range m.aliases {
+		if id == sourceId {
+			m.aliases[alias] = targetId
+		}
+	}
+	delete(m.names, sourceId)
+	m.aliases[sourceName] = targetId
+	return nil
+}
+
+func (m *memoryTags) AddAlias(id int64, alias string) error {
+	if m.taken(alias, 0) {
+		return domain.ErrTagExists
+	}
+	if _, ok := m.names[id]; !ok {
+		return domain.ErrTagNotFound
+	}
+	m.aliases[alias] = id
+	return nil
+}
+
+func (m *memoryTags) RemoveAlias(id int64, alias string) error {
+	if tagId, ok := m.aliases[alias]; !ok || tagId != id {
+		return domain.ErrTagNotFound
+	}
+	delete(m.aliases, alias)
+	return nil
+}
+
+// taggedDrawings lists the drawings of memoryTags.
+type taggedDrawings struct {
+	DrawingsRepository
+	tags *memoryTags
+}
+
+// List matches drawings with any or, with MatchAllTags, all of the filter's tags, by name or alias.
+func (r taggedDrawings) List(filter domain.DrawingFilter) ([]domain.Drawing, error) {
+	drawings := make([]domain.Drawing, 0)
+	for drawingId, tags := range r.tags.drawings {
+		matches := 0
+		for _, name := range filter.Tags {
+			if id, ok := r.tags.resolve(name); ok && tags[id] {
+				matches++
+			}
+		}
+		if len(filter.Tags) == 0 || matches == len(filter.Tags) || !filter.MatchAllTags && matches > 0 {
+			drawings = append(drawings, domain.Drawing{ID: drawingId})
+		}
+	}
+	sort.Slice(drawings, func(i, j int) bool { return drawings[i].ID < drawings[j].ID })
+	return drawings, nil
+}
+
+func (r taggedDrawings) TagsOf(ids []string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	for _, drawingId := range ids {
+		for id := range r.tags.drawings[drawingId] {
+			tags[drawingId] = append(tags[drawingId], r.tags.names[id])
+		}
+		sort.Strings(tags[drawingId])
+	}
+	return tags, nil
+}
+
+func drawingIds(t *testing.T, drawings *DrawingService, tags []string, matchAll bool) []string {
+	t.Helper()
+	list, err := drawings.List(domain.DrawingFilter{Tags: tags, MatchAllTags: matchAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(list))
+	for _, d := range list {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func TestAttachAndDetachTags(t *testing.T) {
+	repo := newMemoryTags("d1")
+	tags := NewTagService(repo)
+	drawings := NewDrawingService(taggedDrawings{tags: repo}, nil, "local", 1<<20, time.Minute, nil)
+
+	if err := tags.Attach("d1", []string{"Digital  Art", "digital art", " cat "}); err != nil {
+		t.Fatal(err)
+	}
+	drawing, err := drawings.withTags([]domain.Drawing{{ID: "d1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cat", "digital art"}; !slices.Equal(drawing[0].Tags, want) {
+		t.Errorf("tags = %v, want %v", drawing[0].Tags, want)
+	}
+
+	if err := tags.Attach("d1", []string{"  "}); !errors.Is(err, domain.ErrInvalidTag) {
+		t.Errorf("attaching a blank tag = %v, want ErrInvalidTag", err)
+	}
+
+	if err := tags.Detach("d1", "CAT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Detach("d1", "cat"); !errors.Is(err, domain.ErrTagNotFound) {
+		t.Errorf("detaching a detached tag = %v, want ErrTagNotFound", err)
+	}
+	if err := tags.Detach("d1", ""); !errors.Is(err, domain.ErrTagNotFound) {
+		t.Errorf("detaching an invalid tag = %v, want ErrTagNotFound", err)
+	}
+}
+
+func TestSearchDrawingsByTags(t *testing.T) {
+	repo := newMemoryTags("d1", "d2", "d3")
+	tags := NewTagService(repo)
+	drawings := NewDrawingService(taggedDrawings{tags: repo}, nil, "local", 1<<20, time.Minute, nil)
+
+	for drawingId, names := range map[string][]string{
+		"d1": {"cat", "sketch"},
+		"d2": {"cat"},
+		"d3": {"dog", "sketch"},
+	} {
+		if err := tags.Attach(drawingId, names); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		matchAll bool
+		want     []string
+	}{
+		{"any of one tag", []string{"cat"}, false, []string{"d1", "d2"}},
+		{"any of two tags", []string{"cat", "dog"}, false, []string{"d1", "d2", "d3"}},
+		{"all of two tags", []string{"CAT", "sketch"}, true, []string{"d1"}},
+		{"all of tags no drawing has together", []string{"cat", "dog"}, true, []string{}},
+		{"unknown tag", []string{"bird"}, false, []string{}},
+		{"invalid tag", []string{""}, false, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := drawingIds(t, drawings, tt.tags, tt.matchAll); !slices.Equal(got, tt.want) {
+				t.Errorf("drawings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeAndAliasTags(t *testing.T) {
+	repo := newMemoryTags("d1", "d2")
+	tags := NewTagService(repo)
+	drawings := NewDrawingService(taggedDrawings{tags: repo}, nil, "local", 1<<20, time.Minute, nil)
+
+	if err := tags.Attach("d1", []string{"kitten"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Attach("d2", []string{"cat"}); err != nil {
+		t.Fatal(err)
+	}
+	kitten, _ := repo.resolve("kitten")
+	cat, _ := repo.resolve("cat")
+
+	if err := tags.Merge(cat, cat); !errors.Is(err, domain.ErrMergeSameTags) {
+		t.Errorf("merging a tag into itself = %v, want ErrMergeSameTags", err)
+	}
+	if err := tags.Merge(kitten, cat); err != nil {
+		t.Fatal(err)
+	}
+
+	// the merged name keeps finding its drawings and is attached as the tag it stands for
+	if got := drawingIds(t, drawings, []string{"kitten"}, false); !slices.Equal(got, []string{"d1", "d2"}) {
+		t.Errorf("drawings tagged kitten = %v", got)
+	}
+	if err := tags.Attach("d1", []string{"Kitten"}); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := tags.Get(cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tag.Aliases, []string{"kitten"}) {
+		t.Errorf("aliases = %v, want [kitten]", tag.Aliases)
+	}
+
+	if err := tags.AddAlias(cat, "Kitty"); err != nil {
+		t.Fatal(err)
+	}
+	if got := drawingIds(t, drawings, []string{"kitty", "cat"}, true); !slices.Equal(got, []string{"d1", "d2"}) {
+		t.Errorf("drawings tagged kitty and cat = %v", got)
+	}
+
+	for name, err := range map[string]error{
+		"cat":    tags.AddAlias(cat, "cat"),
+		"kitten": tags.AddAlias(cat, "kitten"),
+	} {
+		if !errors.Is(err, domain.ErrTagExists) {
+			t.Errorf("alias %s = %v, want ErrTagExists", name, err)
+		}
+	}
+
+	if err := tags.RemoveAlias(cat, "kitty"); err != nil {
+		t.Fatal(err)
+	}
+	if got := drawingIds(t, drawings, []string{"kitty"}, false); len(got) != 0 {
+		t.Errorf("removed alias still finds %v", got)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	repo := newMemoryTags("d1")
+	tags := NewTagService(repo)
+
+	if err := tags.Attach("d1", []string{"cat", "dog"}); err != nil {
+		t.Fatal(err)
+	}
+	cat, _ := repo.resolve("cat")
+	if err := tags.AddAlias(cat, "kitty"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		to   string
+		err  error
+	}{
+		{"to its own name", "Cat", nil},
+		{"to the name of another tag", "dog", domain.ErrTagExists},
+		{"to its own alias", "kitty", nil},
+		{"to a new name", "feline", nil},
+		{"to an invalid name", " ", domain.ErrInvalidTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tags.Rename(cat, tt.to); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	tag, err := tags.Get(cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Name != "feline" || len(tag.Aliases) != 0 {
+		t.Errorf("tag = %+v, want feline without the alias it was renamed to", tag)
+	}
+}
@@ -1,54 +1,179 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"github.com/dankru/Commissions_simple/internal/domain"
+	"log"
+	"slices"
 )
 
 type UserRepository interface {
-	GetAll() ([]domain.User, error)
-	GetById(id int64) (domain.User, error)
-	Replace(id int64, user domain.User) error
-	Update(id int64, userInp domain.UserInput) error
-	Delete(id int64) error
+	List(query domain.UserQuery) ([]domain.User, error)
+	Count(filter domain.UserFilter) (int, error)
+	GetById(id string) (domain.User, error)
+	GetByIds(ids []string) ([]domain.User, error)
+	Replace(id string, user domain.User) error
+	Update(id string, userInp domain.UserInput) error
+	Delete(id string) error
 }
 
 type PasswordHasher interface {
 	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// EmailVerifier sends a verification link to an address that isn't verified yet.
+type EmailVerifier interface {
+	ResendEmailVerification(ctx context.Context, email string) error
 }
 
 type Service struct {
-	repository UserRepository
-	hasher     PasswordHasher
-	hmacSecret []byte
+	repository    UserRepository
+	hasher        PasswordHasher
+	audit         *AuditLog
+	emailVerifier EmailVerifier
+	hmacSecret    []byte
 }
 
-func NewService(repository UserRepository) *Service {
+func NewService(repository UserRepository, hasher PasswordHasher, audit *AuditLog, emailVerifier EmailVerifier) *Service {
 	return &Service{
-		repository: repository,
+		repository:    repository,
+		hasher:        hasher,
+		audit:         audit,
+		emailVerifier: emailVerifier,
 	}
 }
 
-func (s *Service) GetAll() ([]domain.User, error) {
-	users, err := s.repository.GetAll()
-	return users, err
-}
-
-func (s *Service) GetById(id int64) (domain.User, error) {
+func (s *Service) GetById(id string) (domain.User, error) {
 	user, err := s.repository.GetById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, domain.ErrUserNotFound
+	}
 	return user, err
 }
 
-func (s *Service) Replace(id int64, user domain.User) error {
-	err := s.repository.Replace(id, user)
+// GetByIds returns the users that exist, in no particular order.
+func (s *Service) GetByIds(ids []string) ([]domain.User, error) {
+	return s.repository.GetByIds(ids)
+}
+
+func (s *Service) Replace(ctx context.Context, id string, user domain.User) error {
+	before, err := s.repository.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	changes := domain.UserInput{
+		Username:  &user.Username,
+		Email:     &user.Email,
+		Role:      &user.Role,
+		AvatarURL: user.AvatarURL,
+		Bio:       user.Bio,
+	}
+	// a replace always carries a password, only a different one counts as a change
+	if same, err := s.hasher.Verify(user.Password, before.Password); err != nil || !same {
+		changes.Password = &user.Password
+	}
+
+	password, err := s.hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = password
+
+	err = s.repository.Replace(id, user)
+	s.auditChanges(ctx, before, changes, err)
+	if err == nil {
+		s.verifyChangedEmail(ctx, before, changes)
+	}
 	return err
 }
 
-func (s *Service) Update(id int64, userInp domain.UserInput) error {
-	err := s.repository.Update(id, userInp)
+func (s *Service) Update(ctx context.Context, id string, userInp domain.UserInput) error {
+	before, err := s.repository.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	if userInp.Password != nil {
+		password, err := s.hasher.Hash(*userInp.Password)
+		if err != nil {
+			return err
+		}
+		userInp.Password = &password
+	}
+
+	err = s.repository.Update(id, userInp)
+	s.auditChanges(ctx, before, userInp, err)
+	if err == nil {
+		s.verifyChangedEmail(ctx, before, userInp)
+	}
 	return err
 }
 
-func (s *Service) Delete(id int64) error {
+// verifyChangedEmail sends a verification link to the new address, the repository has already
+// marked it unverified. The change stands when the mail fails, the link can be requested again.
+func (s *Service) verifyChangedEmail(ctx context.Context, before domain.User, changes domain.UserInput) {
+	if changes.Email == nil || *changes.Email == before.Email {
+		return
+	}
+
+	if err := s.emailVerifier.ResendEmailVerification(ctx, *changes.Email); err != nil {
+		log.Printf("failed to send verification email to user %s: %s", before.ID, err.Error())
+	}
+}
+
+// auditChanges records the update, and separately the changes of credentials and privileges.
+func (s *Service) auditChanges(ctx context.Context, before domain.User, changes domain.UserInput, err error) {
+	fields := make([]string, 0)
+	for field, changed := range map[string]bool{
+		"username":   changes.Username != nil,
+		"email":      changes.Email != nil,
+		"password":   changes.Password != nil,
+		"role":       changes.Role != nil,
+		"avatar_url": changes.AvatarURL != nil,
+		"bio":        changes.Bio != nil,
+	} {
+		if changed {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+
+	s.audit.Record(ctx, domain.AuditEvent{
+		Action:   domain.AuditUserUpdated,
+		TargetID: before.ID,
+		Metadata: map[string]any{"fields": fields},
+	}, err)
+
+	if err != nil {
+		return
+	}
+
+	if changes.Email != nil && *changes.Email != before.Email {
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:   domain.AuditEmailChanged,
+			TargetID: before.ID,
+			Metadata: map[string]any{"old_email": before.Email, "new_email": *changes.Email},
+		}, nil)
+	}
+	if changes.Role != nil && *changes.Role != before.Role {
+		s.audit.Record(ctx, domain.AuditEvent{
+			Action:   domain.AuditRoleChanged,
+			TargetID: before.ID,
+			Metadata: map[string]any{"old_role": before.Role, "new_role": *changes.Role},
+		}, nil)
+	}
+	if changes.Password != nil {
+		s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditPasswordChanged, TargetID: before.ID}, nil)
+	}
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
 	err := s.repository.Delete(id)
+	s.audit.Record(ctx, domain.AuditEvent{Action: domain.AuditUserDeleted, TargetID: id}, err)
 	return err
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"time"
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
+// cursorTimeLayout matches the precision of a postgres timestamp, so the value compares equal when cast back.
+const cursorTimeLayout = "2006-01-02T15:04:05.999999"
+
+// userCursor is encoded into the opaque next cursor. It remembers the order it was made for,
+// a cursor is meaningless in another one.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// List returns a page of users matching the query and the number of matches on all pages.
+// The next page is requested with After set to the page's NextCursor.
+func (s *Service) List(query domain.UserQuery) (domain.UserPage, error) {
+	if query.Sort == "" {
+		query.Sort = domain.UserSortRegisteredAt
+	}
+	if query.Sort != domain.UserSortRegisteredAt && query.Sort != domain.UserSortUsername {
+		return domain.UserPage{}, domain.ErrInvalidSortField
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultUsersPageSize
+	}
+	query.Limit = min(query.Limit, maxUsersPageSize)
+
+	if query.After != "" {
+		cursor, err := decodeUserCursor(query.After, query.Sort, query.Desc)
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+		query.Cursor = cursor
+	}
+
+	limit := query.Limit
+	// one more row tells whether there is a next page
+	query.Limit++
+
+	users, err := s.repository.List(query)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	total, err := s.repository.Count(query.Filter)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	page := domain.UserPage{Users: users, Total: total}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor, err = encodeUserCursor(query, page.Users[limit-1])
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// decodeUserCursor checks that the cursor was made for the given order and returns the position it holds.
+func decodeUserCursor(cursor string, sort string, desc bool) (*domain.UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.Desc != desc || !domain.IsUUID(c.ID) {
+		return nil, domain.ErrInvalidCursor
+	}
+	if c.Sort == domain.UserSortRegisteredAt {
+		if _, err := time.Parse(cursorTimeLayout, c.Value); err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+	}
+
+	return &domain.UserCursor{Value: c.Value, ID: c.ID}, nil
+}
+
+func encodeUserCursor(query domain.UserQuery, last domain.User) (string, error) {
+	c := userCursor{Sort: query.Sort, Desc: query.Desc, ID: last.ID}
+	switch query.Sort {
+	case domain.UserSortRegisteredAt:
+		c.Value = last.RegisteredAt.Format(cursorTimeLayout)
+	case domain.UserSortUsername:
+		c.Value = last.Username
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
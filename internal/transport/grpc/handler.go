@@ -0,0 +1,178 @@
+// Package grpc serves the user API to other services of the stack.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	userspb "github.com/dankru/Commissions_simple/pkg/proto/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"strings"
+)
+
+const maxBatchSize = 1000
+
+type UserService interface {
+	List(query domain.UserQuery) (domain.UserPage, error)
+	GetById(id string) (domain.User, error)
+	GetByIds(ids []string) ([]domain.User, error)
+}
+
+type AuthService interface {
+	ParseToken(ctx context.Context, token string) (string, error)
+}
+
+type APIKeyService interface {
+	Authenticate(plain string) (domain.APIKey, error)
+}
+
+type Handler struct {
+	userspb.UnimplementedUserServiceServer
+
+	userService   UserService
+	authService   AuthService
+	apiKeyService APIKeyService
+}
+
+func NewHandler(userService UserService, authService AuthService, apiKeyService APIKeyService) *Handler {
+	return &Handler{
+		userService:   userService,
+		authService:   authService,
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (h *Handler) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	if !domain.IsUUID(req.GetId()) {
+		return nil, status.Error(codes.InvalidArgument, "id must be a UUID")
+	}
+
+	user, err := h.userService.GetById(strings.ToLower(req.GetId()))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get user: %s", err.Error())
+	}
+
+	return toProtoUser(user), nil
+}
+
+func (h *Handler) GetUsersByIds(ctx context.Context, req *userspb.GetUsersByIdsRequest) (*userspb.GetUsersByIdsResponse, error) {
+	if len(req.GetIds()) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ids can be requested at once", maxBatchSize)
+	}
+
+	ids := make([]string, 0, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		if !domain.IsUUID(id) {
+			return nil, status.Errorf(codes.InvalidArgument, "id %q is not a UUID", id)
+		}
+		ids = append(ids, strings.ToLower(id))
+	}
+
+	users, err := h.userService.GetByIds(ids)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get users: %s", err.Error())
+	}
+
+	found := make(map[string]*userspb.User, len(users))
+	for _, u := range users {
+		found[u.ID] = toProtoUser(u)
+	}
+
+	// users are returned in the order they were asked for
+	resp := &userspb.GetUsersByIdsResponse{}
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			resp.Users = append(resp.Users, u)
+		} else {
+			resp.MissingIds = append(resp.MissingIds, id)
+		}
+	}
+
+	return resp, nil
+}
+
+// IntrospectToken tells whether an access token or API key is valid and whom it belongs to.
+// Invalid tokens give an inactive response rather than an error.
+func (h *Handler) IntrospectToken(ctx context.Context, req *userspb.IntrospectTokenRequest) (*userspb.IntrospectTokenResponse, error) {
+	token := req.GetToken()
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	resp := &userspb.IntrospectTokenResponse{}
+	var userId string
+
+	if strings.HasPrefix(token, domain.APIKeyPrefix) {
+		key, err := h.apiKeyService.Authenticate(token)
+		if err != nil {
+			return &userspb.IntrospectTokenResponse{Active: false}, nil
+		}
+		userId = key.UserID
+		resp.TokenType = "api_key"
+		resp.Scopes = key.Scopes
+	} else {
+		id, err := h.authService.ParseToken(ctx, token)
+		if err != nil {
+			log.Printf("introspection: token rejected: %s", err.Error())
+			return &userspb.IntrospectTokenResponse{Active: false}, nil
+		}
+		userId = id
+		resp.TokenType = "access_token"
+	}
+
+	user, err := h.userService.GetById(userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return &userspb.IntrospectTokenResponse{Active: false}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get user: %s", err.Error())
+	}
+
+	resp.Active = true
+	resp.UserId = user.ID
+	resp.Role = user.Role
+
+	return resp, nil
+}
+
+// ListUsers pages through all users ordered by registration. The page token is the cursor after the last user of the page.
+func (h *Handler) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	page, err := h.userService.List(domain.UserQuery{
+		Sort:  domain.UserSortRegisteredAt,
+		Limit: int(req.GetPageSize()),
+		After: req.GetPageToken(),
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get users: %s", err.Error())
+	}
+
+	resp := &userspb.ListUsersResponse{NextPageToken: page.NextCursor}
+	for _, u := range page.Users {
+		resp.Users = append(resp.Users, toProtoUser(u))
+	}
+
+	return resp, nil
+}
+
+func toProtoUser(u domain.User) *userspb.User {
+	return &userspb.User{
+		Id:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		Role:          u.Role,
+		AvatarUrl:     u.AvatarURL,
+		Bio:           u.Bio,
+		RegisteredAt:  timestamppb.New(u.RegisteredAt),
+		UpdatedAt:     timestamppb.New(u.UpdatedAt),
+		EmailVerified: u.EmailVerifiedAt != nil,
+	}
+}
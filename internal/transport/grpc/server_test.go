@@ -0,0 +1,197 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	userspb "github.com/dankru/Commissions_simple/pkg/proto/users"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"slices"
+	"testing"
+)
+
+const (
+	serviceToken = "service-token"
+	userId       = "11111111-1111-1111-1111-111111111111"
+	missingId    = "22222222-2222-2222-2222-222222222222"
+	accessToken  = "access-token"
+)
+
+// fakeUsers knows the one user with userId.
+type fakeUsers struct {
+	UserService
+}
+
+func (fakeUsers) GetById(id string) (domain.User, error) {
+	if id != userId {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return domain.User{ID: userId, Username: "someone", Role: domain.RoleArtist}, nil
+}
+
+func (fakeUsers) GetByIds(ids []string) ([]domain.User, error) {
+	users := make([]domain.User, 0)
+	if slices.Contains(ids, userId) {
+		users = append(users, domain.User{ID: userId})
+	}
+	return users, nil
+}
+
+// fakeTokens accepts accessToken as the token of userId.
+type fakeTokens struct{}
+
+func (fakeTokens) ParseToken(_ context.Context, token string) (string, error) {
+	if token != accessToken {
+		return "", errors.New("invalid token")
+	}
+	return userId, nil
+}
+
+type fakeAPIKeys struct{}
+
+func (fakeAPIKeys) Authenticate(string) (domain.APIKey, error) {
+	return domain.APIKey{}, domain.ErrInvalidAPIKey
+}
+
+// dial serves the API with the service token over an in-memory connection.
+func dial(t *testing.T, token string) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(NewHandler(fakeUsers{}, fakeTokens{}, fakeAPIKeys{}), token)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestServiceToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		ctx        context.Context
+		code       codes.Code
+	}{
+		{"missing token", serviceToken, context.Background(), codes.Unauthenticated},
+		{"wrong token", serviceToken, withToken("other-token"), codes.Unauthenticated},
+		{"token without the Bearer scheme", serviceToken, metadata.AppendToOutgoingContext(context.Background(), "authorization", serviceToken), codes.Unauthenticated},
+		{"valid token", serviceToken, withToken(serviceToken), codes.OK},
+		{"no token configured", "", withToken(""), codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := userspb.NewUserServiceClient(dial(t, tt.configured))
+
+			_, err := client.GetUser(tt.ctx, &userspb.GetUserRequest{Id: userId})
+			if code := status.Code(err); code != tt.code {
+				t.Errorf("code = %s, want %s: %v", code, tt.code, err)
+			}
+		})
+	}
+}
+
+func TestHealthCheckNeedsNoToken(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t, serviceToken))
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: userspb.UserService_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %s", resp.GetStatus())
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	client := userspb.NewUserServiceClient(dial(t, serviceToken))
+	ctx := withToken(serviceToken)
+
+	tests := []struct {
+		id   string
+		code codes.Code
+	}{
+		{userId, codes.OK},
+		{missingId, codes.NotFound},
+		{"not-a-uuid", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			user, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: tt.id})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %s, want %s: %v", code, tt.code, err)
+			}
+			if tt.code == codes.OK && user.GetUsername() != "someone" {
+				t.Errorf("user = %v", user)
+			}
+		})
+	}
+}
+
+func TestGetUsersByIds(t *testing.T) {
+	client := userspb.NewUserServiceClient(dial(t, serviceToken))
+
+	resp, err := client.GetUsersByIds(withToken(serviceToken), &userspb.GetUsersByIdsRequest{Ids: []string{missingId, userId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetUsers()) != 1 || resp.GetUsers()[0].GetId() != userId || !slices.Equal(resp.GetMissingIds(), []string{missingId}) {
+		t.Errorf("users = %v, missing = %v", resp.GetUsers(), resp.GetMissingIds())
+	}
+
+	_, err = client.GetUsersByIds(withToken(serviceToken), &userspb.GetUsersByIdsRequest{Ids: []string{userId, "x"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("code = %s, want InvalidArgument", status.Code(err))
+	}
+}
+
+func TestIntrospectToken(t *testing.T) {
+	client := userspb.NewUserServiceClient(dial(t, serviceToken))
+	ctx := withToken(serviceToken)
+
+	tests := []struct {
+		name   string
+		token  string
+		active bool
+	}{
+		{"access token", accessToken, true},
+		{"wrong access token", "other-token", false},
+		{"wrong API key", domain.APIKeyPrefix + "0000aaaa_secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.IntrospectToken(ctx, &userspb.IntrospectTokenRequest{Token: tt.token})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.GetActive() != tt.active {
+				t.Errorf("active = %t, want %t", resp.GetActive(), tt.active)
+			}
+			if tt.active && (resp.GetUserId() != userId || resp.GetRole() != domain.RoleArtist) {
+				t.Errorf("introspection = %v", resp)
+			}
+		})
+	}
+
+	if _, err := client.IntrospectToken(ctx, &userspb.IntrospectTokenRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("code without a token = %s, want InvalidArgument", status.Code(err))
+	}
+}
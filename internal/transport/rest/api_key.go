@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+	"time"
+)
+
+type apiKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// createdAPIKeyResponse is the only response that contains the key itself.
+type createdAPIKeyResponse struct {
+	apiKeyResponse
+	Key string `json:"key"`
+}
+
+func toAPIKeyResponse(k domain.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     domain.APIKeyPrefix + k.Prefix,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.APIKeyInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, plain, err := h.apiKeyService.Create(userId, input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create API key: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(createdAPIKeyResponse{
+		apiKeyResponse: toAPIKeyResponse(key),
+		Key:            plain,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+func (h *Handler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.apiKeyService.List(userId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get API keys: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, toAPIKeyResponse(k))
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(userId, id); err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to revoke API key: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
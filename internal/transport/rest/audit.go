@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type auditEventResponse struct {
+	ID        int64          `json:"id"`
+	ActorID   string         `json:"actor_id,omitempty"`
+	TargetID  string         `json:"target_id,omitempty"`
+	Action    string         `json:"action"`
+	IP        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	Outcome   string         `json:"outcome"`
+	Metadata  map[string]any `json:"metadata"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func toAuditEventResponse(e domain.AuditEvent) auditEventResponse {
+	return auditEventResponse{
+		ID:        e.ID,
+		ActorID:   e.ActorID,
+		TargetID:  e.TargetID,
+		Action:    e.Action,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Outcome:   e.Outcome,
+		Metadata:  e.Metadata,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func (h *Handler) initAuditRoutes(router *mux.Router) {
+	audit := router.PathPrefix("/audit-events").Subrouter()
+	{
+		audit.Use(h.rateLimitByIP(rateLimitIP), h.authMiddleware, h.rateLimit(rateLimitAdmin))
+		audit.Handle("", h.authorize(adminOnly, h.getAuditEvents)).Methods(http.MethodGet)
+		audit.Handle("/export", h.authorize(adminOnly, h.exportAuditEvents)).Methods(http.MethodGet)
+	}
+}
+
+// getAuditEvents returns a page of events, newest first. The next page is requested
+// with ?before= set to the id of the last event.
+func (h *Handler) getAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.auditService.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get audit events: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]auditEventResponse, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, toAuditEventResponse(e))
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// exportAuditEvents streams all matching events as newline-delimited JSON.
+func (h *Handler) exportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.Header().Add("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+
+	encoder := json.NewEncoder(w)
+	err = h.auditService.Export(filter, func(e domain.AuditEvent) error {
+		return encoder.Encode(toAuditEventResponse(e))
+	})
+	if err != nil {
+		// the status is already sent, a truncated export is all the client can get
+		log.Printf("failed to export audit events: %s", err.Error())
+	}
+}
+
+func auditFilterFromQuery(query url.Values) (domain.AuditFilter, error) {
+	filter := domain.AuditFilter{
+		Action: query.Get("action"),
+	}
+
+	if userId := query.Get("user_id"); userId != "" {
+		if !domain.IsUUID(userId) {
+			return filter, errors.New("user_id must be a UUID")
+		}
+		filter.UserID = strings.ToLower(userId)
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", param.name)
+		}
+		t = t.UTC()
+		*param.dst = &t
+	}
+
+	if before := query.Get("before"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, errors.New("before must be an event id")
+		}
+		filter.Before = id
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, errors.New("limit must be a positive number")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
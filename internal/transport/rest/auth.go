@@ -6,15 +6,39 @@ import (
 	"fmt"
 	"github.com/dankru/Commissions_simple/internal/domain"
 	"github.com/gorilla/mux"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 func (h *Handler) initAuthRoutes(router *mux.Router) {
 	auth := router.PathPrefix("/auth").Subrouter()
 	{
+		auth.Use(h.rateLimit(rateLimitAuth))
 		auth.HandleFunc("/sign-up", h.signUp).Methods(http.MethodPost)
 		auth.HandleFunc("/sign-in", h.signIn).Methods(http.MethodGet)
-		auth.HandleFunc("/refresh", h.refresh).Methods(http.MethodGet)
+		auth.HandleFunc("/sign-in/mfa", h.signInMFA).Methods(http.MethodPost)
+		auth.Handle("/refresh", csrfMiddleware(http.HandlerFunc(h.refresh))).Methods(http.MethodPost)
+		auth.Handle("/logout", h.authMiddleware(http.HandlerFunc(h.logoutSession))).Methods(http.MethodPost)
+		auth.Handle("/refresh/logout", csrfMiddleware(http.HandlerFunc(h.logout))).Methods(http.MethodPost)
+		auth.HandleFunc("/verify-email", h.verifyEmail).Methods(http.MethodPost)
+		auth.HandleFunc("/verify-email/resend", h.resendEmailVerification).Methods(http.MethodPost)
+		auth.HandleFunc("/password/forgot", h.forgotPassword).Methods(http.MethodPost)
+		auth.HandleFunc("/password/reset", h.resetPassword).Methods(http.MethodPost)
+		auth.HandleFunc("/oidc/providers", h.getOIDCProviders).Methods(http.MethodGet)
+		auth.HandleFunc("/oidc/{provider}/login", h.oidcLogin).Methods(http.MethodGet)
+		auth.HandleFunc("/oidc/{provider}/callback", h.oidcCallback).Methods(http.MethodGet)
+		auth.Handle("/identities", h.authMiddleware(http.HandlerFunc(h.getIdentities))).Methods(http.MethodGet)
+		auth.Handle("/2fa/enroll", h.authMiddleware(http.HandlerFunc(h.enrollTOTP))).Methods(http.MethodPost)
+		auth.Handle("/2fa/confirm", h.authMiddleware(http.HandlerFunc(h.confirmTOTP))).Methods(http.MethodPost)
+		auth.Handle("/2fa/recovery-codes", h.authMiddleware(http.HandlerFunc(h.regenerateRecoveryCodes))).Methods(http.MethodPost)
+		auth.Handle("/2fa/disable", h.authMiddleware(http.HandlerFunc(h.disableTOTP))).Methods(http.MethodPost)
+		auth.Handle("/api-keys", h.authMiddleware(http.HandlerFunc(h.createAPIKey))).Methods(http.MethodPost)
+		auth.Handle("/api-keys", h.authMiddleware(http.HandlerFunc(h.getAPIKeys))).Methods(http.MethodGet)
+		auth.Handle("/api-keys/{id:"+domain.UUIDPattern+"}", h.authMiddleware(http.HandlerFunc(h.deleteAPIKey))).Methods(http.MethodDelete)
+		auth.Handle("/logout-all", h.authMiddleware(http.HandlerFunc(h.logoutAll))).Methods(http.MethodPost)
+		auth.Handle("/sessions", h.authMiddleware(http.HandlerFunc(h.getSessions))).Methods(http.MethodGet)
+		auth.Handle("/sessions/{id:"+domain.UUIDPattern+"}", h.authMiddleware(http.HandlerFunc(h.deleteSession))).Methods(http.MethodDelete)
 	}
 }
 
@@ -28,7 +52,11 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = h.authService.SignUp(user); err != nil {
+	if err = h.authService.SignUp(r.Context(), user); err != nil {
+		if errors.Is(err, domain.ErrForbidden) {
+			http.Error(w, "admin role can't be requested on sign-up", http.StatusForbidden)
+			return
+		}
 		http.Error(w, fmt.Sprintf("failed to create user: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -50,51 +78,159 @@ func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.authService.SignIn(r.Context(), signInInput)
+	result, err := h.authService.SignIn(r.Context(), signInInput, getClientInfo(r))
 	if err != nil {
-		if errors.Is(err, domain.ErrUserNotFound) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		writeSignInError(w, err)
+		return
+	}
+
+	h.writeSignInResult(w, result)
+}
+
+func writeSignInError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrInvalidCredentials) || errors.Is(err, domain.ErrInvalidMFACode) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, domain.ErrEmailNotVerified) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	var lockedErr *domain.LockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// writeSignInResult responds with the access token and sets the refresh token cookie,
+// or asks for the second factor.
+func (h *Handler) writeSignInResult(w http.ResponseWriter, result domain.SignInResult) {
+	if result.MFAToken != "" {
+		response, err := json.Marshal(map[string]any{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(response)
 		return
 	}
 
 	response, err := json.Marshal(map[string]string{
-		"access_token": accessToken,
+		"access_token": result.AccessToken,
 	})
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Add("Set-Cookie", fmt.Sprintf("refresh-token=%s; HttpOnly", refreshToken))
+	if err := h.setSessionCookies(w, result.RefreshToken, result.SessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
 	w.Write(response)
 }
 
 func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh-token")
+	cookie, err := r.Cookie(refreshTokenCookie)
 	if err != nil {
 		http.Error(w, "refresh-token cookie not found", http.StatusBadRequest)
 		return
 	}
 
-	accessToken, refreshToken, err := h.authService.RefreshTokens(r.Context(), cookie.Value)
+	result, err := h.authService.RefreshTokens(r.Context(), cookie.Value, getClientInfo(r))
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) ||
+			errors.Is(err, domain.ErrRefreshTokenExpired) ||
+			errors.Is(err, domain.ErrRefreshTokenReused) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response, err := json.Marshal(map[string]string{
-		"token": accessToken,
+		"token": result.AccessToken,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Add("Set-Cookie", fmt.Sprintf("refresh-token='%s'; HttpOnly", refreshToken))
+	if err := h.setSessionCookies(w, result.RefreshToken, result.SessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
 	w.Write(response)
 }
+
+// logout ends the session of the refresh token cookie, which is only sent under /auth/refresh.
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshTokenCookie)
+	if err != nil {
+		http.Error(w, "refresh-token cookie not found", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), cookie.Value); err != nil {
+		http.Error(w, fmt.Sprintf("failed to logout: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutSession ends the signed-in user's session named by the session-id cookie.
+func (h *Handler) logoutSession(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionId := getSessionIdFromCookie(r)
+	if sessionId == "" {
+		http.Error(w, "session-id cookie not found", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.EndSession(r.Context(), userId, sessionId); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to logout: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.authService.LogoutAll(r.Context(), userId); err != nil {
+		http.Error(w, fmt.Sprintf("failed to logout: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
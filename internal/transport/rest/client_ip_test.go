@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"untrusted peer can't forward", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed hop left of the client", "10.1.2.3:5000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "192.168.1.1:5000", "198.51.100.1, 10.0.0.5", "", "198.51.100.1"},
+		{"invalid hop", "10.1.2.3:5000", "198.51.100.1, garbage", "", "10.1.2.3"},
+		{"real ip", "10.1.2.3:5000", "", "198.51.100.9", "198.51.100.9"},
+		{"trusted proxy without headers", "10.1.2.3:5000", "", "", "10.1.2.3"},
+		{"ipv4 mapped peer", "[::ffff:10.1.2.3]:5000", "198.51.100.1", "", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := proxies.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	refreshTokenCookie = "refresh-token"
+	sessionIdCookie    = "session-id"
+	csrfTokenCookie    = "csrf-token"
+	csrfTokenHeader    = "X-CSRF-Token"
+)
+
+// CookiePolicy controls the attributes of the refresh token cookie. The cookie is only sent to Path,
+// so every endpoint that reads it lives under /auth/refresh. The rest of /auth gets the session-id cookie.
+type CookiePolicy struct {
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+	// MaxAge should match the refresh token lifetime
+	MaxAge time.Duration
+}
+
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	case "":
+		return http.SameSiteDefaultMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %s", value)
+	}
+}
+
+// setSessionCookies sets the refresh token, the id of its session and a new CSRF token. The session id
+// only tells the other /auth endpoints which of the signed-in user's sessions is the current one.
+// The CSRF cookie is readable by scripts on every path, the frontend echoes it in the X-CSRF-Token header, see csrfMiddleware.
+func (h *Handler) setSessionCookies(w http.ResponseWriter, refreshToken string, sessionId string) error {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Domain:   h.cookies.Domain,
+		Path:     h.cookies.Path,
+		MaxAge:   int(h.cookies.MaxAge.Seconds()),
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionIdCookie,
+		Value:    sessionId,
+		Domain:   h.cookies.Domain,
+		Path:     "/auth",
+		MaxAge:   int(h.cookies.MaxAge.Seconds()),
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Value:    csrfToken,
+		Domain:   h.cookies.Domain,
+		Path:     "/",
+		MaxAge:   int(h.cookies.MaxAge.Seconds()),
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
+	})
+
+	return nil
+}
+
+func (h *Handler) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Domain:   h.cookies.Domain,
+		Path:     h.cookies.Path,
+		MaxAge:   -1,
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionIdCookie,
+		Domain:   h.cookies.Domain,
+		Path:     "/auth",
+		MaxAge:   -1,
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Domain:   h.cookies.Domain,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
+	})
+}
+
+// getSessionIdFromCookie returns the id from the session-id cookie, or "" when it's missing or malformed.
+func getSessionIdFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(sessionIdCookie)
+	if err != nil || !domain.IsUUID(cookie.Value) {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrfMiddleware protects endpoints authenticated by the refresh token cookie with the double-submit check:
+// other sites can make the browser send the cookie but can't read it to copy it into the header.
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(csrfTokenCookie)
+		header := r.Header.Get(csrfTokenHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			http.Error(w, "CSRF token is missing or invalid", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,436 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// multipartOverhead is allowed on top of the file size for the other form fields and part headers.
+const multipartOverhead = 1 << 20
+
+type drawingResponse struct {
+	ID          string    `json:"id"`
+	ArtistID    string    `json:"artist_id"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	Visibility  string    `json:"visibility"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func toDrawingResponse(d domain.Drawing) drawingResponse {
+	return drawingResponse{
+		ID:          d.ID,
+		ArtistID:    d.ArtistID,
+		Title:       d.Title,
+		Description: d.Description,
+		Visibility:  d.Visibility,
+		ContentType: d.ContentType,
+		Size:        d.Size,
+		Tags:        d.Tags,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+func (h *Handler) initDrawingRoutes(router *mux.Router) {
+	drawings := router.PathPrefix("/drawings").Subrouter()
+	{
+		// public drawings and the ones shared by link are readable without signing in
+		drawings.Use(h.optionalAuthMiddleware, h.rateLimit(rateLimitDrawings))
+		drawings.HandleFunc("", h.getDrawings).Methods(http.MethodGet)
+		drawings.Handle("", h.authorize(artistOnly, h.uploadDrawing)).Methods(http.MethodPost)
+		drawings.HandleFunc("/{id:"+domain.UUIDPattern+"}", h.getDrawing).Methods(http.MethodGet)
+		drawings.HandleFunc("/{id:"+domain.UUIDPattern+"}/file", h.getDrawingFile).Methods(http.MethodGet)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(anyUser, h.updateDrawing)).Methods(http.MethodPatch)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(anyUser, h.deleteDrawing)).Methods(http.MethodDelete)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}/tags", h.authorize(anyUser, h.attachTags)).Methods(http.MethodPost)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}/tags/{tag}", h.authorize(anyUser, h.detachTag)).Methods(http.MethodDelete)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}/share-links", h.authorize(anyUser, h.createShareLink)).Methods(http.MethodPost)
+		drawings.Handle("/{id:"+domain.UUIDPattern+"}/share-links/rotate", h.authorize(anyUser, h.rotateShareLinks)).Methods(http.MethodPost)
+	}
+}
+
+// uploadDrawing takes a multipart form with the image in the "file" field and the
+// "title", "description" and "visibility" fields.
+func (h *Handler) uploadDrawing(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.drawingService.MaxFileSize()+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, domain.ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "request must be a multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	input := domain.DrawingInput{
+		Title:      r.FormValue("title"),
+		Visibility: r.FormValue("visibility"),
+	}
+	if description := r.FormValue("description"); description != "" {
+		input.Description = &description
+	}
+
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	drawing, err := h.drawingService.Upload(r.Context(), getPrincipalFromContext(r.Context()).UserID, input, file)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toDrawingResponse(drawing))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// getDrawings returns public drawings and the viewer's own, newest first, paged by ?limit= and ?offset=. ?artist_id= selects the drawings
+// of one artist, and every ?tag= the drawings with any of the tags, or with all of them with ?match=all.
+func (h *Handler) getDrawings(w http.ResponseWriter, r *http.Request) {
+	filter, err := drawingFilterFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.PublicOrOwnedBy = getViewerId(r)
+
+	drawings, err := h.drawingService.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get drawings: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]drawingResponse, 0, len(drawings))
+	for _, d := range drawings {
+		resp = append(resp, toDrawingResponse(d))
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// getDrawing returns the drawing if the viewer may see it. Drawings with link visibility need ?share= set to a share token.
+func (h *Handler) getDrawing(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	drawing, err := h.drawingService.View(getViewerId(r), id, r.URL.Query().Get("share"))
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toDrawingResponse(drawing))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// getDrawingFile redirects to a presigned URL when the file's storage provider makes them, otherwise sends the file.
+func (h *Handler) getDrawingFile(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	viewerId, share := getViewerId(r), r.URL.Query().Get("share")
+
+	_, fileURL, err := h.drawingService.FileURL(r.Context(), viewerId, id, share)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	if fileURL != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, fileURL, http.StatusFound)
+		return
+	}
+
+	drawing, file, err := h.drawingService.Open(r.Context(), viewerId, id, share)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+	defer file.Close()
+
+	// only public drawings may be kept by shared caches
+	if drawing.Visibility != domain.VisibilityPublic {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	w.Header().Set("Content-Type", drawing.ContentType)
+	// drawings uploaded before sizes were recorded have none
+	if drawing.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(drawing.Size, 10))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("failed to send drawing %s: %s", drawing.ID, err.Error())
+	}
+}
+
+// updateDrawing lets the artist change the title, the description and the visibility.
+func (h *Handler) updateDrawing(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.DrawingUpdateInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	drawing, ok := h.ownDrawing(w, r, false)
+	if !ok {
+		return
+	}
+
+	drawing, err = h.drawingService.Update(drawing.ID, input)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toDrawingResponse(drawing))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// deleteDrawing lets the artist delete the drawing, and admins delete any.
+func (h *Handler) deleteDrawing(w http.ResponseWriter, r *http.Request) {
+	drawing, ok := h.ownDrawing(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := h.drawingService.Delete(r.Context(), drawing.ID); err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachTags adds the {"tags": [...]} to the artist's drawing and returns the drawing.
+func (h *Handler) attachTags(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.TagsInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.withOwnDrawing(w, r, func(drawing domain.Drawing) error {
+		return h.tagService.Attach(drawing.ID, input.Tags)
+	})
+}
+
+func (h *Handler) detachTag(w http.ResponseWriter, r *http.Request) {
+	h.withOwnDrawing(w, r, func(drawing domain.Drawing) error {
+		return h.tagService.Detach(drawing.ID, mux.Vars(r)["tag"])
+	})
+}
+
+// createShareLink returns a share link of the artist's drawing, valid until the optional "expires_at"
+// or until the links are rotated.
+func (h *Handler) createShareLink(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.ShareLinkInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	drawing, ok := h.ownDrawing(w, r, false)
+	if !ok {
+		return
+	}
+
+	token, err := h.drawingService.ShareLink(drawing.ID, input.ExpiresAt)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	link := url.URL{Path: "/drawings/" + drawing.ID, RawQuery: url.Values{"share": {token}}.Encode()}
+	response, err := json.Marshal(map[string]any{
+		"token":      token,
+		"url":        link.String(),
+		"expires_at": input.ExpiresAt,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// rotateShareLinks invalidates every share link of the artist's drawing given out so far.
+func (h *Handler) rotateShareLinks(w http.ResponseWriter, r *http.Request) {
+	drawing, ok := h.ownDrawing(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := h.drawingService.RotateShareLinks(drawing.ID); err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getViewerId returns the signed-in user behind optionalAuthMiddleware, or an empty id for anonymous requests.
+func getViewerId(r *http.Request) string {
+	userId, _ := getUserIdFromContext(r.Context())
+	return userId
+}
+
+// withOwnDrawing runs fn on the artist's drawing of the {id} route variable and responds with the drawing
+// as it is afterwards.
+func (h *Handler) withOwnDrawing(w http.ResponseWriter, r *http.Request, fn func(drawing domain.Drawing) error) {
+	drawing, ok := h.ownDrawing(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := fn(drawing); err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	drawing, err := h.drawingService.Get(drawing.ID)
+	if err != nil {
+		writeDrawingError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toDrawingResponse(drawing))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func drawingFilterFromRequest(r *http.Request) (domain.DrawingFilter, error) {
+	query := r.URL.Query()
+	filter := domain.DrawingFilter{}
+
+	if artistId := query.Get("artist_id"); artistId != "" {
+		if !domain.IsUUID(artistId) {
+			return filter, errors.New("artist_id must be a UUID")
+		}
+		filter.ArtistID = strings.ToLower(artistId)
+	}
+
+	filter.Tags = query["tag"]
+	switch query.Get("match") {
+	case "all":
+		filter.MatchAllTags = true
+	case "any", "":
+	default:
+		return filter, errors.New("match must be all or any")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, errors.New("limit must be a positive number")
+		}
+		filter.Limit = n
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return filter, errors.New("offset must be a non-negative number")
+		}
+		filter.Offset = n
+	}
+
+	return filter, nil
+}
+
+func writeDrawingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDrawingNotFound), errors.Is(err, domain.ErrTagNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrUnsupportedMediaType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, domain.ErrFileTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, domain.ErrInvalidTag), errors.Is(err, domain.ErrTooManyTags):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrDrawingNotShareable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("failed to process drawing: %s", err.Error()), http.StatusInternalServerError)
+	}
+}
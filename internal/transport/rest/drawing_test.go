@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDrawingFilterFromRequest(t *testing.T) {
+	tests := []struct {
+		query    string
+		tags     []string
+		matchAll bool
+		valid    bool
+	}{
+		{"?tag=cat&tag=sketch", []string{"cat", "sketch"}, false, true},
+		{"?tag=cat&tag=sketch&match=any", []string{"cat", "sketch"}, false, true},
+		{"?tag=cat&tag=sketch&match=all", []string{"cat", "sketch"}, true, true},
+		{"", nil, false, true},
+		{"?tag=cat&match=both", nil, false, false},
+		{"?artist_id=not-a-uuid", nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			filter, err := drawingFilterFromRequest(httptest.NewRequest(http.MethodGet, "/drawings"+tt.query, nil))
+			if (err == nil) != tt.valid {
+				t.Fatalf("err = %v, want valid = %t", err, tt.valid)
+			}
+			if tt.valid && (!slices.Equal(filter.Tags, tt.tags) || filter.MatchAllTags != tt.matchAll) {
+				t.Errorf("tags = %v, match all = %t", filter.Tags, filter.MatchAllTags)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"time"
+)
+
+// Users are never marshalled directly: every response goes through one of the representations below,
+// picked by who is asking, so new domain fields stay private until they are added here on purpose.
+
+// publicUser is what any signed-in user sees about somebody else.
+type publicUser struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Role         string    `json:"role"`
+	AvatarURL    *string   `json:"avatar_url"`
+	Bio          *string   `json:"bio"`
+	RegisteredAt time.Time `json:"registered_at"`
+	// Rating is only shown on the profile
+	Rating *ratingResponse `json:"rating,omitempty"`
+}
+
+// selfUser is what users see about themselves.
+type selfUser struct {
+	publicUser
+	Email            string     `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// adminUser is what admins see about anyone, including the state they can reset.
+type adminUser struct {
+	selfUser
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	FailedSignIns int        `json:"failed_sign_ins"`
+	// LockedUntil is set while sign-in to the account is locked
+	LockedUntil *time.Time `json:"locked_until"`
+}
+
+func toPublicUser(u domain.User) publicUser {
+	return publicUser{
+		ID:           u.ID,
+		Username:     u.Username,
+		Role:         u.Role,
+		AvatarURL:    u.AvatarURL,
+		Bio:          u.Bio,
+		RegisteredAt: u.RegisteredAt,
+	}
+}
+
+func toSelfUser(u domain.User) selfUser {
+	return selfUser{
+		publicUser:       toPublicUser(u),
+		Email:            u.Email,
+		EmailVerifiedAt:  u.EmailVerifiedAt,
+		TwoFactorEnabled: u.TOTPEnabledAt != nil,
+		UpdatedAt:        u.UpdatedAt,
+	}
+}
+
+func toAdminUser(u domain.User) adminUser {
+	resp := adminUser{
+		selfUser:      toSelfUser(u),
+		TOTPEnabledAt: u.TOTPEnabledAt,
+		FailedSignIns: u.FailedSignIns,
+	}
+	if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		resp.LockedUntil = u.LockedUntil
+	}
+	return resp
+}
+
+// toUserResponse picks the representation of u the principal is allowed to see.
+func toUserResponse(p principal, u domain.User) any {
+	switch {
+	case p.isAdmin():
+		return toAdminUser(u)
+	case p.UserID == u.ID:
+		return toSelfUser(u)
+	default:
+		return toPublicUser(u)
+	}
+}
+
+// toProfileResponse is toUserResponse with the user's rating, as shown on the profile.
+func toProfileResponse(p principal, u domain.User, summary domain.RatingSummary) any {
+	rating := toRatingResponse(summary)
+	switch {
+	case p.isAdmin():
+		resp := toAdminUser(u)
+		resp.Rating = &rating
+		return resp
+	case p.UserID == u.ID:
+		resp := toSelfUser(u)
+		resp.Rating = &rating
+		return resp
+	default:
+		resp := toPublicUser(u)
+		resp.Rating = &rating
+		return resp
+	}
+}
+
+func toUsersResponse(p principal, users []domain.User) []any {
+	resp := make([]any, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, toUserResponse(p, u))
+	}
+	return resp
+}
+
+// userFromInput builds the full replacement of a user from a validated PUT body.
+func userFromInput(input domain.UserInput) domain.User {
+	return domain.User{
+		Username:  *input.Username,
+		Email:     *input.Email,
+		Password:  *input.Password,
+		Role:      *input.Role,
+		AvatarURL: input.AvatarURL,
+		Bio:       input.Bio,
+	}
+}
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.TokenInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.VerifyEmail(r.Context(), input.Token); err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to verify email: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) resendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.EmailInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ResendEmailVerification(r.Context(), input.Email); err != nil {
+		http.Error(w, fmt.Sprintf("failed to send email: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
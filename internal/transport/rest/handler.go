@@ -8,65 +8,166 @@ import (
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 )
 
 type CtxValue int
 
 const (
 	ctxUserId CtxValue = iota
+	ctxPrincipal
+	ctxAPIKey
 )
 
 type AuthService interface {
-	SignUp(user domain.UserInput) error
-	SignIn(ctx context.Context, signInInput domain.SignInInput) (string, string, error)
-	ParseToken(ctx context.Context, token string) (int64, error)
-	RefreshTokens(ctx context.Context, refreshToken string) (string, string, error)
+	SignUp(ctx context.Context, user domain.UserInput) error
+	SignIn(ctx context.Context, signInInput domain.SignInInput, client domain.ClientInfo) (domain.SignInResult, error)
+	SignInMFA(ctx context.Context, input domain.MFASignInInput, client domain.ClientInfo) (domain.SignInResult, error)
+	ParseToken(ctx context.Context, token string) (string, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.SignInResult, error)
+	Logout(ctx context.Context, refreshToken string) error
+	EndSession(ctx context.Context, userId string, sessionId string) error
+	LogoutAll(ctx context.Context, userId string) error
+	ListSessions(userId string, currentSessionId string) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userId string, sessionId string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendEmailVerification(ctx context.Context, email string) error
+	ForgotPassword(ctx context.Context, email string)
+	ResetPassword(ctx context.Context, token string, password string) error
+	UnlockAccount(ctx context.Context, userId string) error
+	EnrollTOTP(userId string) (domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId string, code string) ([]string, error)
+	RegenerateRecoveryCodes(ctx context.Context, userId string, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userId string, code string) error
+	ResetMFA(ctx context.Context, userId string) error
+	OIDCProviders() []string
+	StartOIDCLogin(ctx context.Context, provider string) (string, string, error)
+	FinishOIDCLogin(ctx context.Context, provider string, state string, code string, client domain.ClientInfo) (domain.SignInResult, error)
+	ListIdentities(userId string) ([]domain.ExternalIdentity, error)
 }
 
 type UserService interface {
-	GetAll() ([]domain.User, error)
-	GetById(id int64) (domain.User, error)
-	Replace(id int64, user domain.User) error
-	Update(id int64, userInp domain.UserInput) error
-	Delete(id int64) error
+	List(query domain.UserQuery) (domain.UserPage, error)
+	GetById(id string) (domain.User, error)
+	Replace(ctx context.Context, id string, user domain.User) error
+	Update(ctx context.Context, id string, userInp domain.UserInput) error
+	Delete(ctx context.Context, id string) error
+}
+
+type ReviewService interface {
+	Create(reviewerId string, revieweeId string, input domain.ReviewInput) (domain.Review, error)
+	Get(revieweeId string, id int64) (domain.Review, error)
+	List(revieweeId string, limit int, offset int) ([]domain.Review, error)
+	Update(reviewerId string, revieweeId string, id int64, input domain.ReviewInput) (domain.Review, error)
+	Delete(reviewerId string, revieweeId string, id int64) error
+	Remove(revieweeId string, id int64) error
+	Summary(revieweeId string) (domain.RatingSummary, error)
+}
+
+type DrawingService interface {
+	Upload(ctx context.Context, artistId string, input domain.DrawingInput, file io.Reader) (domain.Drawing, error)
+	Get(id string) (domain.Drawing, error)
+	View(viewerId string, id string, shareToken string) (domain.Drawing, error)
+	Open(ctx context.Context, viewerId string, id string, shareToken string) (domain.Drawing, io.ReadCloser, error)
+	FileURL(ctx context.Context, viewerId string, id string, shareToken string) (domain.Drawing, string, error)
+	ShareLink(id string, expiresAt *time.Time) (string, error)
+	RotateShareLinks(id string) error
+	List(filter domain.DrawingFilter) ([]domain.Drawing, error)
+	Update(id string, input domain.DrawingUpdateInput) (domain.Drawing, error)
+	Delete(ctx context.Context, id string) error
+	MaxFileSize() int64
+}
+
+type TagService interface {
+	Attach(drawingId string, names []string) error
+	Detach(drawingId string, name string) error
+	Autocomplete(prefix string, limit int) ([]domain.Tag, error)
+	Get(id int64) (domain.Tag, error)
+	Rename(id int64, name string) error
+	Merge(sourceId int64, targetId int64) error
+	AddAlias(id int64, alias string) error
+	RemoveAlias(id int64, alias string) error
+}
+
+type AuditService interface {
+	List(filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	Export(filter domain.AuditFilter, fn func(domain.AuditEvent) error) error
+}
+
+type APIKeyService interface {
+	Create(userId string, input domain.APIKeyInput) (domain.APIKey, string, error)
+	List(userId string) ([]domain.APIKey, error)
+	Revoke(userId string, id string) error
+	Authenticate(plain string) (domain.APIKey, error)
 }
 
 type Handler struct {
-	authService AuthService
-	userService UserService
+	authService    AuthService
+	userService    UserService
+	apiKeyService  APIKeyService
+	reviewService  ReviewService
+	drawingService DrawingService
+	tagService     TagService
+	auditService   AuditService
+	cookies        CookiePolicy
+	trustedProxies TrustedProxies
+	rateLimiter    RateLimiter
 }
 
-func NewHandler(authService AuthService, userService UserService) *Handler {
+// NewHandler creates the handler. rateLimiter may be nil, then requests aren't limited.
+func NewHandler(authService AuthService, userService UserService, apiKeyService APIKeyService, reviewService ReviewService,
+	drawingService DrawingService, tagService TagService, auditService AuditService, cookies CookiePolicy, trustedProxies TrustedProxies,
+	rateLimiter RateLimiter) *Handler {
 	return &Handler{
-		authService: authService,
-		userService: userService,
+		authService:    authService,
+		userService:    userService,
+		apiKeyService:  apiKeyService,
+		reviewService:  reviewService,
+		drawingService: drawingService,
+		tagService:     tagService,
+		auditService:   auditService,
+		cookies:        cookies,
+		trustedProxies: trustedProxies,
+		rateLimiter:    rateLimiter,
 	}
 }
 
 func (h *Handler) InitRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.StrictSlash(true)
-	r.Use(loggingMiddleware)
+	r.Use(loggingMiddleware, h.clientInfoMiddleware)
 	h.initAuthRoutes(r)
 	h.initUserRoutes(r)
+	h.initAuditRoutes(r)
+	h.initDrawingRoutes(r)
+	h.initTagRoutes(r)
 	return r
 }
 
-func getIdFromRequest(r *http.Request) (int64, error) {
-	vars := mux.Vars(r)
-	id, err := strconv.ParseInt(vars["id"], 10, 64)
-	if err != nil {
-		return 0, err
+func getIdFromRequest(r *http.Request) (string, error) {
+	id := mux.Vars(r)["id"]
+	if !domain.IsUUID(id) {
+		return "", errors.New("id must be a UUID")
 	}
 
-	if id == 0 {
-		return 0, errors.New("id can't be 0")
+	return strings.ToLower(id), nil
+}
+
+func getUserIdFromContext(ctx context.Context) (string, error) {
+	id, ok := ctx.Value(ctxUserId).(string)
+	if !ok || id == "" {
+		return "", errors.New("user is not authenticated")
 	}
 
 	return id, nil
 }
 
+// getClientInfo returns the client resolved by clientInfoMiddleware.
+func getClientInfo(r *http.Request) domain.ClientInfo {
+	return domain.ClientInfoFromContext(r.Context())
+}
+
 func decodeJsonBody[T domain.Input](r *http.Request) (T, error) {
 	var dst T
 
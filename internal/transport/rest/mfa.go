@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) signInMFA(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeJsonBody[domain.MFASignInInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.authService.SignInMFA(r.Context(), input, getClientInfo(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		writeSignInError(w, err)
+		return
+	}
+
+	h.writeSignInResult(w, result)
+}
+
+func (h *Handler) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.authService.EnrollTOTP(userId)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, func(userId string, code string) error {
+		codes, err := h.authService.ConfirmTOTP(r.Context(), userId, code)
+		if err != nil {
+			return err
+		}
+		writeRecoveryCodes(w, codes)
+		return nil
+	})
+}
+
+func (h *Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, func(userId string, code string) error {
+		codes, err := h.authService.RegenerateRecoveryCodes(r.Context(), userId, code)
+		if err != nil {
+			return err
+		}
+		writeRecoveryCodes(w, codes)
+		return nil
+	})
+}
+
+func (h *Handler) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, func(userId string, code string) error {
+		if err := h.authService.DisableTOTP(r.Context(), userId, code); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (h *Handler) resetUserMFA(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ResetMFA(r.Context(), id); err != nil {
+		http.Error(w, fmt.Sprintf("failed to reset two-factor authentication: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withMFACode decodes the {"code": ...} body of the signed-in user's 2FA requests.
+func (h *Handler) withMFACode(w http.ResponseWriter, r *http.Request, fn func(userId string, code string) error) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.MFACodeInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := fn(userId, input.Code); err != nil {
+		writeMFAError(w, err)
+	}
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled),
+		errors.Is(err, domain.ErrMFANotEnabled),
+		errors.Is(err, domain.ErrMFAEnrollmentNeeded):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("two-factor authentication failed: %s", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	response, err := json.Marshal(map[string][]string{
+		"recovery_codes": codes,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -3,11 +3,14 @@ package rest
 import (
 	"context"
 	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
 	"log"
 	"net/http"
 	"strings"
 )
 
+// authMiddleware accepts only access tokens of signed-in users.
 func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := getTokenFromRequest(r)
@@ -16,6 +19,11 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if isAPIKey(token) {
+			http.Error(w, "API keys are not accepted here", http.StatusUnauthorized)
+			return
+		}
+
 		userId, err := h.authService.ParseToken(r.Context(), token)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -23,22 +31,108 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), ctxUserId, userId)
+		ctx = domain.WithActor(ctx, userId)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// optionalAuthMiddleware lets anonymous requests through and authenticates the rest like authMiddleware.
+// Handlers behind it find no user id in the context for anonymous requests.
+func (h *Handler) optionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.authMiddleware(next).ServeHTTP(w, r)
+	})
+}
+
+// apiKeyOrAuthMiddleware accepts access tokens and API keys. Requests made with an API key
+// carry its scopes in the context, see requireScopes.
+func (h *Handler) apiKeyOrAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := getTokenFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if !isAPIKey(token) {
+			h.authMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+
+		key, err := h.apiKeyService.Authenticate(token)
+		if err != nil {
+			http.Error(w, domain.ErrInvalidAPIKey.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxUserId, key.UserID)
+		ctx = context.WithValue(ctx, ctxAPIKey, key)
+		ctx = domain.WithActor(ctx, key.UserID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScopes checks the scope of API key requests: safe methods need read, the rest need write.
+// Requests of signed-in users aren't limited by scopes.
+func requireScopes(read, write string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(ctxAPIKey).(domain.APIKey)
+			if ok {
+				scope := write
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					scope = read
+				}
+
+				if !key.HasScope(scope) {
+					http.Error(w, domain.ErrInsufficientScope.Error(), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[%s] ", r.Method, r.RequestURI)
+		log.Printf("[%s] %s", r.Method, r.RequestURI)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// clientInfoMiddleware resolves the client behind the trusted proxies once, for lockouts, rate limits
+// and audit events alike.
+func (h *Handler) clientInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := domain.ClientInfo{
+			IP:        h.trustedProxies.clientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+		next.ServeHTTP(w, r.WithContext(domain.WithClientInfo(r.Context(), client)))
+	})
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, domain.APIKeyPrefix)
+}
+
+// getTokenFromRequest reads "Authorization: Bearer <token>", where the token is a JWT or an API key.
+// API keys can also be sent as "X-API-Key: <key>".
 func getTokenFromRequest(r *http.Request) (string, error) {
 	header := r.Header.Get("Authorization")
 	if header == "" {
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			return key, nil
+		}
 		return "", errors.New("Empty auth header")
 	}
 
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	oidcStateCookie = "oidc-state"
+	oidcCookiePath  = "/auth/oidc"
+)
+
+type identityResponse struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func (h *Handler) getOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(h.authService.OIDCProviders())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// oidcLogin redirects to the provider. The state cookie ties the callback to the browser that started the login.
+func (h *Handler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.authService.StartOIDCLogin(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownProvider) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to start login at %s: %s", mux.Vars(r)["provider"], err.Error())
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Domain:   h.cookies.Domain,
+		Path:     oidcCookiePath,
+		HttpOnly: true,
+		Secure:   h.cookies.Secure,
+		// Lax, because the provider sends the user back with a cross-site top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *Handler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Domain:   h.cookies.Domain,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.cookies.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, "identity provider refused the login: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || code == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, domain.ErrInvalidOIDCState.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.authService.FinishOIDCLogin(r.Context(), mux.Vars(r)["provider"], state, code, getClientInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnknownProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrInvalidOIDCState):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, domain.ErrProviderEmailMissing), errors.Is(err, domain.ErrIdentityLinkNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("failed to finish login at %s: %s", mux.Vars(r)["provider"], err.Error())
+			http.Error(w, "failed to sign in with the identity provider", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.writeSignInResult(w, result)
+}
+
+func (h *Handler) getIdentities(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.authService.ListIdentities(userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]identityResponse, 0, len(identities))
+	for _, i := range identities {
+		resp = append(resp, identityResponse{
+			Provider:    i.Provider,
+			Email:       i.Email,
+			CreatedAt:   i.CreatedAt,
+			LastLoginAt: i.LastLoginAt,
+		})
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
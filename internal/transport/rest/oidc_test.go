@@ -0,0 +1,455 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/internal/service"
+	"github.com/dankru/Commissions_simple/pkg/oidc"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const oidcClientId = "commissions"
+
+// oidcStub is an OpenID Connect provider that approves every login with the configured claims.
+type oidcStub struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	logins map[string]url.Values
+}
+
+func newOIDCStub(t *testing.T) *oidcStub {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &oidcStub{key: key, logins: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/authorize", stub.authorize)
+	mux.HandleFunc("/token", stub.token)
+	mux.HandleFunc("/jwks", stub.jwks)
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *oidcStub) discovery(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+// authorize stands in for the user approving the login: it redirects straight back with a code.
+func (s *oidcStub) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != oidcClientId ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := strconv.FormatInt(time.Now().UnixNano(), 36)
+	s.mu.Lock()
+	s.logins[code] = query
+	s.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *oidcStub) token(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	login, ok := s.logins[r.PostFormValue("code")]
+	delete(s.logins, r.PostFormValue("code"))
+	claims := jwt.MapClaims{}
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+	s.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != login.Get("code_challenge") ||
+		r.PostFormValue("redirect_uri") != login.Get("redirect_uri") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims["iss"] = s.URL
+	claims["aud"] = oidcClientId
+	claims["nonce"] = login.Get("nonce")
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub"
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+}
+
+func (s *oidcStub) jwks(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "stub",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+	}}})
+}
+
+func (s *oidcStub) signInAs(claims jwt.MapClaims) {
+	s.mu.Lock()
+	s.claims = claims
+	s.mu.Unlock()
+}
+
+// oidcUsers keeps users and their external identities in memory.
+type oidcUsers struct {
+	mu         sync.Mutex
+	users      map[string]domain.User
+	identities map[string]domain.ExternalIdentity
+	states     map[string]domain.OIDCState
+	sessions   []domain.RefreshSession
+}
+
+func newOIDCUsers() *oidcUsers {
+	return &oidcUsers{
+		users:      make(map[string]domain.User),
+		identities: make(map[string]domain.ExternalIdentity),
+		states:     make(map[string]domain.OIDCState),
+	}
+}
+
+func (u *oidcUsers) add(user domain.User) domain.User {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", len(u.users)+1)
+	user.AuthID = int64(len(u.users) + 1)
+	u.users[user.ID] = user
+	return user
+}
+
+type oidcAuthRepository struct {
+	service.AuthRepository
+	*oidcUsers
+}
+
+func (r oidcAuthRepository) GetById(id string) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r oidcAuthRepository) GetByEmail(email string) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return domain.User{}, sql.ErrNoRows
+}
+
+type oidcIdentitiesRepository struct {
+	service.ExternalIdentitiesRepository
+	*oidcUsers
+}
+
+func (r oidcIdentitiesRepository) CreateState(state domain.OIDCState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[state.StateHash] = state
+	return nil
+}
+
+func (r oidcIdentitiesRepository) ConsumeState(stateHash string, provider string) (domain.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[stateHash]
+	delete(r.states, stateHash)
+	if !ok || state.Provider != provider || state.ExpiresAt.Before(time.Now()) {
+		return domain.OIDCState{}, domain.ErrInvalidOIDCState
+	}
+	return state, nil
+}
+
+func (r oidcIdentitiesRepository) GetUserId(provider string, subject string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[provider+"/"+subject]
+	if !ok {
+		return "", domain.ErrUserNotFound
+	}
+	return identity.UserID, nil
+}
+
+func (r oidcIdentitiesRepository) Link(identity domain.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.identities[identity.Provider+"/"+identity.Subject] = identity
+	return nil
+}
+
+func (r oidcIdentitiesRepository) CreateUser(user domain.User, identity domain.ExternalIdentity) (string, error) {
+	user = r.add(user)
+	identity.UserID = user.ID
+	return user.ID, r.Link(identity)
+}
+
+type oidcSessionsRepository struct {
+	service.SessionsRepository
+	*oidcUsers
+}
+
+func (r oidcSessionsRepository) Create(session domain.RefreshSession) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.FamilyID = fmt.Sprintf("00000000-0000-0000-0000-%012d", len(r.sessions)+1)
+	r.sessions = append(r.sessions, session)
+	return session.FamilyID, nil
+}
+
+// oidcTokens issues access tokens that name the auth id, so the test can tell who signed in.
+type oidcTokens struct {
+	service.GrpcClient
+}
+
+func (oidcTokens) GenerateToken(_ context.Context, authId int64) (string, string, error) {
+	return fmt.Sprintf("access-%d", authId), "", nil
+}
+
+type oidcHasher struct {
+	service.PasswordHasher
+}
+
+func (oidcHasher) Hash(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+type oidcAuditRepository struct {
+	service.AuditRepository
+	mu     sync.Mutex
+	events []domain.AuditEvent
+}
+
+func (r *oidcAuditRepository) Append(event domain.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *oidcAuditRepository) has(action string, targetId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.events {
+		if e.Action == action && e.TargetID == targetId && e.Outcome == domain.AuditSuccess {
+			return true
+		}
+	}
+	return false
+}
+
+// TestOIDCLogin drives the whole login: /auth/oidc/{provider}/login, the provider, the callback and
+// finding, linking or creating the account.
+func TestOIDCLogin(t *testing.T) {
+	stub := newOIDCStub(t)
+	users := newOIDCUsers()
+	audit := &oidcAuditRepository{}
+
+	var router http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	defer app.Close()
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      stub.URL,
+		ClientID:    oidcClientId,
+		RedirectURL: app.URL + "/auth/oidc/mock/callback",
+	})
+	authService := service.NewAuthService(oidcAuthRepository{oidcUsers: users}, oidcSessionsRepository{oidcUsers: users},
+		nil, nil, nil, oidcIdentitiesRepository{oidcUsers: users}, map[string]service.OIDCProvider{"mock": provider},
+		oidcHasher{}, oidcTokens{}, nil, nil, service.NewAuditLog(audit),
+		service.AuthConfig{RefreshTokenTTL: time.Hour, OIDCStateTTL: time.Minute})
+	router = NewHandler(authService, nil, nil, nil, nil, nil, nil, CookiePolicy{Path: "/auth/refresh"}, nil, nil).InitRouter()
+
+	// login follows the redirects like a browser and returns the callback's response
+	login := func(t *testing.T) (int, map[string]string) {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+
+		resp, err := client.Get(app.URL + "/auth/oidc/mock/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body := make(map[string]string)
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	verifiedAt := time.Now()
+	verified := users.add(domain.User{Username: "verified", Email: "verified@example.com", EmailVerifiedAt: &verifiedAt})
+	unverified := users.add(domain.User{Username: "unverified", Email: "unverified@example.com"})
+
+	t.Run("links the user with the same verified email", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "alice", "email": verified.Email, "email_verified": true})
+
+		status, body := login(t)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		if want := fmt.Sprintf("access-%d", verified.AuthID); body["access_token"] != want {
+			t.Errorf("access token = %q, want %q", body["access_token"], want)
+		}
+		if id, _ := (oidcIdentitiesRepository{oidcUsers: users}).GetUserId("mock", "alice"); id != verified.ID {
+			t.Errorf("identity is linked to %q, want %q", id, verified.ID)
+		}
+		if !audit.has(domain.AuditIdentityLinked, verified.ID) {
+			t.Error("linking isn't audited")
+		}
+	})
+
+	t.Run("signs the linked identity in again", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "alice", "email": "changed@example.com", "email_verified": true})
+
+		status, body := login(t)
+		if status != http.StatusOK || body["access_token"] != fmt.Sprintf("access-%d", verified.AuthID) {
+			t.Fatalf("status = %d, body = %v", status, body)
+		}
+	})
+
+	t.Run("doesn't link an unverified account", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "mallory", "email": unverified.Email, "email_verified": true})
+
+		if status, _ := login(t); status != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", status)
+		}
+		if _, err := (oidcIdentitiesRepository{oidcUsers: users}).GetUserId("mock", "mallory"); err == nil {
+			t.Error("identity is linked")
+		}
+	})
+
+	t.Run("doesn't trust an unverified provider email", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "eve", "email": verified.Email, "email_verified": false})
+
+		if status, _ := login(t); status != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", status)
+		}
+	})
+
+	t.Run("creates a user for an unknown email", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "bob", "email": "bob@example.com", "email_verified": true, "preferred_username": "bob"})
+
+		status, _ := login(t)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+
+		user, err := (oidcAuthRepository{oidcUsers: users}).GetByEmail("bob@example.com")
+		if err != nil {
+			t.Fatal("user isn't created")
+		}
+		if user.Username != "bob" || user.Role != domain.RoleBuyer {
+			t.Errorf("user = %+v", user)
+		}
+	})
+
+	t.Run("rejects a callback without the state cookie", func(t *testing.T) {
+		stub.signInAs(jwt.MapClaims{"sub": "alice", "email": verified.Email, "email_verified": true})
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(app.URL + "/auth/oidc/mock/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// the provider redirects back, but to a browser that didn't start the login
+		resp, err = http.Get(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+}
+
+type fakeOIDCAuthService struct {
+	fakeAuthService
+}
+
+func (fakeOIDCAuthService) StartOIDCLogin(context.Context, string) (string, string, error) {
+	return "https://idp.example.com/authorize", "state", nil
+}
+
+func TestOIDCStateCookieFollowsCookiePolicy(t *testing.T) {
+	cookies := CookiePolicy{Domain: "example.com", Path: "/auth/refresh", Secure: true, SameSite: http.SameSiteStrictMode}
+	router := NewHandler(fakeOIDCAuthService{}, nil, nil, nil, nil, nil, nil, cookies, nil, nil).InitRouter()
+
+	// behind a TLS terminating proxy the request itself is plain HTTP
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != oidcStateCookie || !cookie.Secure || cookie.Domain != cookies.Domain || !cookie.HttpOnly {
+		t.Errorf("state cookie = %+v", cookie)
+	}
+	// the provider redirects back cross-site, a Strict cookie wouldn't be sent with the callback
+	if cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("SameSite = %v, want Lax", cookie.SameSite)
+	}
+}
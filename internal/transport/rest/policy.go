@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"context"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+)
+
+// principal is the signed-in user a request is made on behalf of.
+type principal struct {
+	UserID string
+	Role   string
+}
+
+func (p principal) isAdmin() bool {
+	return p.Role == domain.RoleAdmin
+}
+
+// policy decides whether the principal may perform the request.
+type policy func(p principal, r *http.Request) bool
+
+// anyUser allows every signed-in user.
+func anyUser(principal, *http.Request) bool {
+	return true
+}
+
+func adminOnly(p principal, _ *http.Request) bool {
+	return p.isAdmin()
+}
+
+// artistOnly allows users who sell drawings.
+func artistOnly(p principal, _ *http.Request) bool {
+	return p.Role == domain.RoleArtist || p.Role == domain.RoleBoth
+}
+
+// ownerOrAdmin allows the user the {id} route variable points to, and admins.
+func ownerOrAdmin(p principal, r *http.Request) bool {
+	if p.isAdmin() {
+		return true
+	}
+
+	id, err := getIdFromRequest(r)
+	return err == nil && id == p.UserID
+}
+
+// canAssignRole reports whether the principal may give a user the role. Only admins can grant admin.
+func canAssignRole(p principal, role string) bool {
+	return role != domain.RoleAdmin || p.isAdmin()
+}
+
+// authorize must run after authMiddleware. It loads the principal's role and rejects the request
+// with 403 unless the policy allows it.
+func (h *Handler) authorize(allow policy, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := getUserIdFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		user, err := h.userService.GetById(userId)
+		if err != nil {
+			http.Error(w, "failed to find user", http.StatusUnauthorized)
+			return
+		}
+
+		p := principal{UserID: user.ID, Role: user.Role}
+		if !allow(p, r) {
+			http.Error(w, domain.ErrForbidden.Error(), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxPrincipal, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getPrincipalFromContext(ctx context.Context) principal {
+	p, _ := ctx.Value(ctxPrincipal).(principal)
+	return p
+}
+
+// ownDrawing returns the drawing of the {id} route variable if it belongs to the principal, or to anyone
+// for admins when allowAdmin is set. Other users get 404 for drawings they can't view, like from View,
+// and 403 for public ones.
+func (h *Handler) ownDrawing(w http.ResponseWriter, r *http.Request, allowAdmin bool) (domain.Drawing, bool) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return domain.Drawing{}, false
+	}
+
+	drawing, err := h.drawingService.Get(id)
+	if err != nil {
+		writeDrawingError(w, err)
+		return domain.Drawing{}, false
+	}
+
+	p := getPrincipalFromContext(r.Context())
+	switch {
+	case drawing.ArtistID == p.UserID, allowAdmin && p.isAdmin():
+		return drawing, true
+	case drawing.Visibility == domain.VisibilityPublic:
+		http.Error(w, domain.ErrForbidden.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, domain.ErrDrawingNotFound.Error(), http.StatusNotFound)
+	}
+	return domain.Drawing{}, false
+}
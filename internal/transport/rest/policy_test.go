@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	buyerId  = "11111111-1111-1111-1111-111111111111"
+	otherId  = "22222222-2222-2222-2222-222222222222"
+	adminId  = "33333333-3333-3333-3333-333333333333"
+	userJson = `{"username":"someone","email":"someone@example.com","password":"secret123","role":"buyer"}`
+)
+
+// fakeAuthService accepts the tokens it knows, a token is the id of the user it belongs to.
+type fakeAuthService struct {
+	AuthService
+}
+
+func (fakeAuthService) ParseToken(_ context.Context, token string) (string, error) {
+	switch token {
+	case buyerId, otherId, adminId:
+		return token, nil
+	default:
+		return "", errors.New("invalid token")
+	}
+}
+
+// fakeUserService records the users that were changed.
+type fakeUserService struct {
+	UserService
+	changed []string
+}
+
+func (f *fakeUserService) GetById(id string) (domain.User, error) {
+	role := domain.RoleBuyer
+	if id == adminId {
+		role = domain.RoleAdmin
+	}
+	return domain.User{ID: id, Role: role}, nil
+}
+
+func (f *fakeUserService) Replace(_ context.Context, id string, _ domain.User) error {
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeUserService) Update(_ context.Context, id string, _ domain.UserInput) error {
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeUserService) Delete(_ context.Context, id string) error {
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func TestUserRoutesPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"anonymous", "", http.MethodPatch, buyerId, `{}`, http.StatusUnauthorized},
+
+		{"replace other user", buyerId, http.MethodPut, otherId, userJson, http.StatusForbidden},
+		{"update other user", buyerId, http.MethodPatch, otherId, `{"bio":"hi"}`, http.StatusForbidden},
+		{"delete other user", buyerId, http.MethodDelete, otherId, "", http.StatusForbidden},
+
+		{"replace self", buyerId, http.MethodPut, buyerId, userJson, http.StatusOK},
+		{"update self", buyerId, http.MethodPatch, buyerId, `{"bio":"hi"}`, http.StatusOK},
+		{"delete self", buyerId, http.MethodDelete, buyerId, "", http.StatusNoContent},
+
+		{"admin replaces user", adminId, http.MethodPut, otherId, userJson, http.StatusOK},
+		{"admin updates user", adminId, http.MethodPatch, otherId, `{"bio":"hi"}`, http.StatusOK},
+		{"admin deletes user", adminId, http.MethodDelete, otherId, "", http.StatusNoContent},
+
+		{"self promotion by update", buyerId, http.MethodPatch, buyerId, `{"role":"admin"}`, http.StatusForbidden},
+		{"self promotion by replace", buyerId, http.MethodPut, buyerId, strings.Replace(userJson, `"buyer"`, `"admin"`, 1), http.StatusForbidden},
+		{"role change to artist", buyerId, http.MethodPatch, buyerId, `{"role":"artist"}`, http.StatusOK},
+		{"admin grants admin", adminId, http.MethodPatch, otherId, `{"role":"admin"}`, http.StatusOK},
+
+		{"update to an unknown role", buyerId, http.MethodPatch, buyerId, `{"role":"owner"}`, http.StatusBadRequest},
+		{"update with an invalid email", buyerId, http.MethodPatch, buyerId, `{"email":"not an email"}`, http.StatusBadRequest},
+		{"update with a short password", buyerId, http.MethodPatch, buyerId, `{"password":"123"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserService{}
+			router := NewHandler(fakeAuthService{}, users, nil, nil, nil, nil, nil, CookiePolicy{}, nil, nil).InitRouter()
+
+			req := httptest.NewRequest(tt.method, "/users/"+tt.target, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+
+			changed := len(users.changed) > 0
+			if allowed := tt.status < 300; changed != allowed {
+				t.Errorf("user changed = %t, want %t", changed, allowed)
+			}
+		})
+	}
+}
+
+// fakeDrawingService has a public, a link and a private drawing of otherId and records the drawings that were changed.
+type fakeDrawingService struct {
+	DrawingService
+	changed []string
+}
+
+var drawingVisibilities = map[string]string{
+	"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa": domain.VisibilityPublic,
+	"bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb": domain.VisibilityLink,
+	"cccccccc-cccc-cccc-cccc-cccccccccccc": domain.VisibilityPrivate,
+}
+
+func (f *fakeDrawingService) Get(id string) (domain.Drawing, error) {
+	visibility, ok := drawingVisibilities[id]
+	if !ok {
+		return domain.Drawing{}, domain.ErrDrawingNotFound
+	}
+	return domain.Drawing{ID: id, ArtistID: otherId, Visibility: visibility}, nil
+}
+
+func (f *fakeDrawingService) Update(id string, _ domain.DrawingUpdateInput) (domain.Drawing, error) {
+	f.changed = append(f.changed, id)
+	return f.Get(id)
+}
+
+func (f *fakeDrawingService) Delete(_ context.Context, id string) error {
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeDrawingService) RotateShareLinks(id string) error {
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func TestDrawingRoutesOwnership(t *testing.T) {
+	const (
+		public  = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+		link    = "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"
+		private = "cccccccc-cccc-cccc-cccc-cccccccccccc"
+		missing = "dddddddd-dddd-dddd-dddd-dddddddddddd"
+	)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"owner updates", otherId, http.MethodPatch, private, `{"title":"new"}`, http.StatusOK},
+		{"owner deletes", otherId, http.MethodDelete, private, "", http.StatusNoContent},
+		{"owner rotates share links", otherId, http.MethodPost, link + "/share-links/rotate", "", http.StatusNoContent},
+		{"admin deletes", adminId, http.MethodDelete, private, "", http.StatusNoContent},
+
+		{"update public drawing of another artist", buyerId, http.MethodPatch, public, `{"title":"new"}`, http.StatusForbidden},
+		{"update private drawing of another artist", buyerId, http.MethodPatch, private, `{"title":"new"}`, http.StatusNotFound},
+		{"delete link drawing of another artist", buyerId, http.MethodDelete, link, "", http.StatusNotFound},
+		{"rotate share links of another artist", buyerId, http.MethodPost, link + "/share-links/rotate", "", http.StatusNotFound},
+		{"tag private drawing of another artist", buyerId, http.MethodPost, private + "/tags", `{"tags":["cat"]}`, http.StatusNotFound},
+		{"admin updates", adminId, http.MethodPatch, private, `{"title":"new"}`, http.StatusNotFound},
+		{"missing drawing", buyerId, http.MethodDelete, missing, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drawings := &fakeDrawingService{}
+			router := NewHandler(fakeAuthService{}, &fakeUserService{}, nil, nil, drawings, nil, nil, CookiePolicy{}, nil, nil).InitRouter()
+
+			req := httptest.NewRequest(tt.method, "/drawings/"+tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+
+			changed := len(drawings.changed) > 0
+			if allowed := tt.status < 300; changed != allowed {
+				t.Errorf("drawing changed = %t, want %t", changed, allowed)
+			}
+		})
+	}
+}
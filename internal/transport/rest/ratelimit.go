@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/dankru/Commissions_simple/pkg/ratelimit"
+	"github.com/gorilla/mux"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Rate limit policies of the route groups.
+const (
+	rateLimitAuth     = "auth"
+	rateLimitUsers    = "users"
+	rateLimitAdmin    = "admin"
+	rateLimitDrawings = "drawings"
+	// rateLimitIP counts every request of an IP in front of the auth middlewares, so invalid credentials are limited too
+	rateLimitIP = "ip"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, policy string, key string) (ratelimit.Result, error)
+}
+
+// rateLimit limits requests per client under the named policy. Behind the auth middlewares clients are
+// told apart by API key or user, otherwise by IP. Requests are let through when the store fails.
+func (h *Handler) rateLimit(policy string) mux.MiddlewareFunc {
+	return h.limitBy(policy, rateLimitKey)
+}
+
+// rateLimitByIP limits requests per client IP, whoever they authenticate as.
+func (h *Handler) rateLimitByIP(policy string) mux.MiddlewareFunc {
+	return h.limitBy(policy, rateLimitIPKey)
+}
+
+func (h *Handler) limitBy(policy string, key func(r *http.Request) string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if h.rateLimiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := h.rateLimiter.Allow(r.Context(), policy, key(r))
+			if err != nil {
+				log.Printf("rate limiter is unavailable: %s", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if key, ok := r.Context().Value(ctxAPIKey).(domain.APIKey); ok {
+		return "key:" + key.ID
+	}
+	if userId, err := getUserIdFromContext(r.Context()); err == nil {
+		return "user:" + userId
+	}
+
+	return rateLimitIPKey(r)
+}
+
+func rateLimitIPKey(r *http.Request) string {
+	return fmt.Sprintf("ip:%s", getClientInfo(r).IP)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
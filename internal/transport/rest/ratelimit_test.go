@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"context"
+	"github.com/dankru/Commissions_simple/pkg/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// exhaustedLimiter rejects every request of one policy.
+type exhaustedLimiter struct {
+	policy string
+}
+
+func (l exhaustedLimiter) Allow(_ context.Context, policy string, _ string) (ratelimit.Result, error) {
+	return ratelimit.Result{Allowed: policy != l.policy}, nil
+}
+
+func TestInvalidCredentialsAreRateLimited(t *testing.T) {
+	router := NewHandler(fakeAuthService{}, &fakeUserService{}, nil, nil, nil, nil, nil, CookiePolicy{}, nil,
+		exhaustedLimiter{policy: rateLimitIP}).InitRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+buyerId, nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,249 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type reviewResponse struct {
+	ID         int64     `json:"id"`
+	ReviewerID string    `json:"reviewer_id"`
+	RevieweeID string    `json:"reviewee_id"`
+	Rating     int       `json:"rating"`
+	Comment    *string   `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ratingResponse struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+	// Histogram is keyed by rating, "1" to "5"
+	Histogram map[int]int `json:"histogram"`
+}
+
+func toReviewResponse(r domain.Review) reviewResponse {
+	return reviewResponse{
+		ID:         r.ID,
+		ReviewerID: r.ReviewerID,
+		RevieweeID: r.RevieweeID,
+		Rating:     r.Rating,
+		Comment:    r.Comment,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+}
+
+func toRatingResponse(s domain.RatingSummary) ratingResponse {
+	return ratingResponse{
+		Average:   s.Average,
+		Count:     s.Count,
+		Histogram: s.Histogram,
+	}
+}
+
+func (h *Handler) initReviewRoutes(users *mux.Router) {
+	reviews := users.PathPrefix("/{id:" + domain.UUIDPattern + "}/reviews").Subrouter()
+	{
+		reviews.Handle("", h.authorize(anyUser, h.getReviews)).Methods(http.MethodGet)
+		reviews.Handle("", h.authorize(anyUser, h.createReview)).Methods(http.MethodPost)
+		reviews.Handle("/{reviewId:[0-9]+}", h.authorize(anyUser, h.getReview)).Methods(http.MethodGet)
+		reviews.Handle("/{reviewId:[0-9]+}", h.authorize(anyUser, h.replaceReview)).Methods(http.MethodPut)
+		reviews.Handle("/{reviewId:[0-9]+}", h.authorize(anyUser, h.deleteReview)).Methods(http.MethodDelete)
+	}
+}
+
+func (h *Handler) createReview(w http.ResponseWriter, r *http.Request) {
+	revieweeId, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.ReviewInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.reviewService.Create(getPrincipalFromContext(r.Context()).UserID, revieweeId, input)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toReviewResponse(review))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// getReviews returns the user's reviews, newest first, paged by ?limit= and ?offset=.
+func (h *Handler) getReviews(w http.ResponseWriter, r *http.Request) {
+	revieweeId, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := 0, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reviews, err := h.reviewService.List(revieweeId, limit, offset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get reviews: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]reviewResponse, 0, len(reviews))
+	for _, review := range reviews {
+		resp = append(resp, toReviewResponse(review))
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) getReview(w http.ResponseWriter, r *http.Request) {
+	revieweeId, reviewId, err := getReviewIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.reviewService.Get(revieweeId, reviewId)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toReviewResponse(review))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// replaceReview lets the author change the rating and the comment.
+func (h *Handler) replaceReview(w http.ResponseWriter, r *http.Request) {
+	revieweeId, reviewId, err := getReviewIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.ReviewInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.reviewService.Update(getPrincipalFromContext(r.Context()).UserID, revieweeId, reviewId, input)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(toReviewResponse(review))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// deleteReview lets the author withdraw the review, and admins remove any.
+func (h *Handler) deleteReview(w http.ResponseWriter, r *http.Request) {
+	revieweeId, reviewId, err := getReviewIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	p := getPrincipalFromContext(r.Context())
+	if p.isAdmin() {
+		err = h.reviewService.Remove(revieweeId, reviewId)
+	} else {
+		err = h.reviewService.Delete(p.UserID, revieweeId, reviewId)
+	}
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getReviewIdFromRequest(r *http.Request) (string, int64, error) {
+	revieweeId, err := getIdFromRequest(r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	reviewId, err := strconv.ParseInt(mux.Vars(r)["reviewId"], 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return revieweeId, reviewId, nil
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrSelfReview):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrReviewNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrDuplicateReview):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, domain.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, fmt.Sprintf("failed to process review: %s", err.Error()), http.StatusInternalServerError)
+	}
+}
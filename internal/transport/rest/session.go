@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+func (h *Handler) getSessions(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(userId, getSessionIdFromCookie(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get sessions: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         s.ID,
+			Device:     deviceFromUserAgent(s.UserAgent),
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			Current:    s.Current,
+		})
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshall sessions: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) deleteSession(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionId, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userId, sessionId); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to revoke session: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deviceFromUserAgent gives a rough, human readable name of the client for the sessions list.
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	platforms := []struct{ marker, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"mac os", "macOS"},
+		{"linux", "Linux"},
+	}
+
+	for _, p := range platforms {
+		if strings.Contains(ua, p.marker) {
+			return p.name
+		}
+	}
+
+	return "Unknown"
+}
@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+const (
+	sessionId      = "44444444-4444-4444-4444-444444444444"
+	otherSessionId = "55555555-5555-5555-5555-555555555555"
+)
+
+// fakeSessionAuthService knows two sessions of buyerId and records the user and id of the ones that were ended.
+type fakeSessionAuthService struct {
+	fakeAuthService
+	ended []string
+}
+
+func (f *fakeSessionAuthService) ListSessions(_ string, currentSessionId string) ([]domain.Session, error) {
+	return []domain.Session{
+		{ID: sessionId, Current: sessionId == currentSessionId},
+		{ID: otherSessionId, Current: otherSessionId == currentSessionId},
+	}, nil
+}
+
+func (f *fakeSessionAuthService) EndSession(_ context.Context, userId string, id string) error {
+	f.ended = append(f.ended, userId+":"+id)
+	return nil
+}
+
+func TestGetSessionsMarksCurrentBySessionCookie(t *testing.T) {
+	router := NewHandler(&fakeSessionAuthService{}, nil, nil, nil, nil, nil, nil, CookiePolicy{Path: "/auth/refresh"}, nil, nil).InitRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+buyerId)
+	req.AddCookie(&http.Cookie{Name: sessionIdCookie, Value: otherSessionId})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var sessions []sessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions {
+		if s.Current != (s.ID == otherSessionId) {
+			t.Errorf("session %s current = %t", s.ID, s.Current)
+		}
+	}
+}
+
+func TestLogoutBySessionCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		ended  []string
+	}{
+		{"anonymous", "", http.StatusUnauthorized, nil},
+		{"signed in", buyerId, http.StatusNoContent, []string{buyerId + ":" + sessionId}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &fakeSessionAuthService{}
+			router := NewHandler(auth, nil, nil, nil, nil, nil, nil, CookiePolicy{Path: "/auth/refresh"}, nil, nil).InitRouter()
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+			req.AddCookie(&http.Cookie{Name: sessionIdCookie, Value: sessionId})
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if !slices.Equal(auth.ended, tt.ended) {
+				t.Errorf("ended sessions = %v, want %v", auth.ended, tt.ended)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type tagResponse struct {
+	ID      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Uses    int      `json:"uses"`
+}
+
+func toTagResponse(t domain.Tag) tagResponse {
+	return tagResponse{
+		ID:      t.ID,
+		Name:    t.Name,
+		Aliases: t.Aliases,
+		Uses:    t.Uses,
+	}
+}
+
+func (h *Handler) initTagRoutes(router *mux.Router) {
+	tags := router.PathPrefix("/tags").Subrouter()
+	{
+		tags.Use(h.rateLimitByIP(rateLimitIP), h.authMiddleware, h.rateLimit(rateLimitDrawings))
+		tags.Handle("", h.authorize(anyUser, h.autocompleteTags)).Methods(http.MethodGet)
+		tags.Handle("/{tagId:[0-9]+}", h.authorize(anyUser, h.getTag)).Methods(http.MethodGet)
+		tags.Handle("/{tagId:[0-9]+}", h.authorize(adminOnly, h.renameTag)).Methods(http.MethodPatch)
+		tags.Handle("/{tagId:[0-9]+}/merge", h.authorize(adminOnly, h.mergeTag)).Methods(http.MethodPost)
+		tags.Handle("/{tagId:[0-9]+}/aliases", h.authorize(adminOnly, h.addTagAlias)).Methods(http.MethodPost)
+		tags.Handle("/{tagId:[0-9]+}/aliases/{alias}", h.authorize(adminOnly, h.removeTagAlias)).Methods(http.MethodDelete)
+	}
+}
+
+// autocompleteTags returns the most used tags whose name or alias starts with ?prefix=.
+func (h *Handler) autocompleteTags(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tags, err := h.tagService.Autocomplete(r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	resp := make([]tagResponse, 0, len(tags))
+	for _, t := range tags {
+		resp = append(resp, toTagResponse(t))
+	}
+
+	writeTagResponse(w, resp)
+}
+
+func (h *Handler) getTag(w http.ResponseWriter, r *http.Request) {
+	id, err := getTagIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.tagService.Get(id)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	writeTagResponse(w, toTagResponse(tag))
+}
+
+func (h *Handler) renameTag(w http.ResponseWriter, r *http.Request) {
+	h.withTagInput(w, r, func(id int64, input domain.TagNameInput) error {
+		return h.tagService.Rename(id, input.Name)
+	})
+}
+
+func (h *Handler) addTagAlias(w http.ResponseWriter, r *http.Request) {
+	h.withTagInput(w, r, func(id int64, input domain.TagNameInput) error {
+		return h.tagService.AddAlias(id, input.Name)
+	})
+}
+
+// mergeTag moves the drawings of the tag to the {"into": id} tag and deletes it. Its name becomes an alias.
+func (h *Handler) mergeTag(w http.ResponseWriter, r *http.Request) {
+	id, err := getTagIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.TagMergeInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.tagService.Merge(id, input.Into); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	tag, err := h.tagService.Get(input.Into)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	writeTagResponse(w, toTagResponse(tag))
+}
+
+func (h *Handler) removeTagAlias(w http.ResponseWriter, r *http.Request) {
+	id, err := getTagIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.tagService.RemoveAlias(id, mux.Vars(r)["alias"]); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withTagInput decodes the {"name": ...} body of the admin's tag changes and responds with the changed tag.
+func (h *Handler) withTagInput(w http.ResponseWriter, r *http.Request, fn func(id int64, input domain.TagNameInput) error) {
+	id, err := getTagIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	input, err := decodeJsonBody[domain.TagNameInput](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := fn(id, input); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	tag, err := h.tagService.Get(id)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	writeTagResponse(w, toTagResponse(tag))
+}
+
+func getTagIdFromRequest(r *http.Request) (int64, error) {
+	return strconv.ParseInt(mux.Vars(r)["tagId"], 10, 64)
+}
+
+func writeTagResponse(w http.ResponseWriter, v any) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func writeTagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrTagNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrInvalidTag), errors.Is(err, domain.ErrMergeSameTags):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrTagExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("failed to process tag: %s", err.Error()), http.StatusInternalServerError)
+	}
+}
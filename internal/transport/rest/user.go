@@ -2,38 +2,143 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dankru/Commissions_simple/internal/domain"
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func (h *Handler) initUserRoutes(router *mux.Router) {
 	users := router.PathPrefix("/users").Subrouter()
 	{
-		users.Use(h.authMiddleware)
-		users.HandleFunc("", h.getUsers).Methods(http.MethodGet)
-		users.HandleFunc("/{id:[0-9]+}", h.getUserById).Methods(http.MethodGet)
-		users.HandleFunc("/{id:[0-9]+}", h.replaceUser).Methods(http.MethodPut)
-		users.HandleFunc("/{id:[0-9]+}", h.updateUser).Methods(http.MethodPatch)
-		users.HandleFunc("/{id:[0-9]+}", h.deleteUser).Methods(http.MethodDelete)
+		users.Use(h.rateLimitByIP(rateLimitIP), h.apiKeyOrAuthMiddleware, h.rateLimit(rateLimitUsers), requireScopes(domain.ScopeUsersRead, domain.ScopeUsersWrite))
+		users.Handle("", h.authorize(anyUser, h.getUsers)).Methods(http.MethodGet)
+		users.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(anyUser, h.getUserById)).Methods(http.MethodGet)
+		users.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(ownerOrAdmin, h.replaceUser)).Methods(http.MethodPut)
+		users.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(ownerOrAdmin, h.updateUser)).Methods(http.MethodPatch)
+		users.Handle("/{id:"+domain.UUIDPattern+"}", h.authorize(ownerOrAdmin, h.deleteUser)).Methods(http.MethodDelete)
+		users.Handle("/{id:"+domain.UUIDPattern+"}/lockout", h.authorize(adminOnly, h.unlockUser)).Methods(http.MethodDelete)
+		users.Handle("/{id:"+domain.UUIDPattern+"}/2fa", h.authorize(adminOnly, h.resetUserMFA)).Methods(http.MethodDelete)
+		h.initReviewRoutes(users)
 	}
 }
 
+// getUsers returns a page of users. Pages are requested either by ?offset= or by ?cursor= set to
+// the X-Next-Cursor of the previous page; the Link header points to the next page in the same way.
 func (h *Handler) getUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.GetAll()
+	p := getPrincipalFromContext(r.Context())
+
+	query, err := userQueryFromRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// an email filter would let anyone check whether an address is registered
+	if query.Filter.Email != "" && !p.isAdmin() {
+		http.Error(w, domain.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	page, err := h.userService.List(query)
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) || errors.Is(err, domain.ErrInvalidSortField) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("failed to get users: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	resp, err := json.Marshal(users)
+	resp, err := json.Marshal(toUsersResponse(p, page.Users))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to marshall users: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
-	w.Write([]byte(resp))
+
+	w.Header().Add("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Add("X-Next-Cursor", page.NextCursor)
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, nextUsersPageURL(r, query, page)))
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func userQueryFromRequest(values url.Values) (domain.UserQuery, error) {
+	query := domain.UserQuery{
+		Filter: domain.UserFilter{
+			Email:          values.Get("email"),
+			UsernamePrefix: values.Get("username_prefix"),
+			Role:           values.Get("role"),
+		},
+		After: values.Get("cursor"),
+	}
+
+	// sort=-registered_at sorts descending
+	if sort := values.Get("sort"); sort != "" {
+		query.Sort = strings.TrimPrefix(sort, "-")
+		query.Desc = strings.HasPrefix(sort, "-")
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"registered_from", &query.Filter.RegisteredFrom},
+		{"registered_to", &query.Filter.RegisteredTo},
+	} {
+		value := values.Get(param.name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, fmt.Errorf("%s must be an RFC 3339 time", param.name)
+		}
+		t = t.UTC()
+		*param.dst = &t
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return query, errors.New("limit must be a positive number")
+		}
+		query.Limit = n
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return query, errors.New("offset must be a non-negative number")
+		}
+		if query.After != "" {
+			return query, errors.New("offset and cursor can't be used together")
+		}
+		query.Offset = n
+	}
+
+	return query, nil
+}
+
+func nextUsersPageURL(r *http.Request, query domain.UserQuery, page domain.UserPage) string {
+	values := r.URL.Query()
+	if values.Has("offset") {
+		values.Set("offset", strconv.Itoa(query.Offset+len(page.Users)))
+	} else {
+		values.Set("cursor", page.NextCursor)
+	}
+
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	return next.String()
 }
 
 func (h *Handler) getUserById(w http.ResponseWriter, r *http.Request) {
@@ -48,7 +153,14 @@ func (h *Handler) getUserById(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to find user", http.StatusInternalServerError)
 		return
 	}
-	response, err := json.Marshal(user)
+
+	rating, err := h.reviewService.Summary(id)
+	if err != nil {
+		http.Error(w, "failed to get user rating", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(toProfileResponse(getPrincipalFromContext(r.Context()), user, rating))
 	if err != nil {
 		http.Error(w, "failed to marshall user", http.StatusInternalServerError)
 		return
@@ -70,13 +182,29 @@ func (h *Handler) replaceUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user domain.User
-	if err := json.Unmarshal(reqBytes, &user); err != nil {
+	var userInp domain.UserInput
+	if err := json.Unmarshal(reqBytes, &userInp); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.userService.Replace(id, user); err != nil {
+	if err := userInp.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if userInp.Role == nil {
+		http.Error(w, "role is required", http.StatusBadRequest)
+		return
+	}
+
+	user := userFromInput(userInp)
+	if !canAssignRole(getPrincipalFromContext(r.Context()), user.Role) {
+		http.Error(w, domain.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.Replace(r.Context(), id, user); err != nil {
 		http.Error(w, fmt.Sprintf("failed to update user: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -101,7 +229,17 @@ func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.Update(id, userInp); err != nil {
+	if err := userInp.ValidateUpdate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if userInp.Role != nil && !canAssignRole(getPrincipalFromContext(r.Context()), *userInp.Role) {
+		http.Error(w, domain.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.Update(r.Context(), id, userInp); err != nil {
 		http.Error(w, fmt.Sprintf("failed to update user: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -114,10 +252,29 @@ func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.Delete(id); err != nil {
+	if err := h.userService.Delete(r.Context(), id); err != nil {
 		http.Error(w, "failed to delete user", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *Handler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.UnlockAccount(r.Context(), id); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to unlock user: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,289 @@
+// Package migrate applies golang-migrate style "<version>_<name>.(up|down).sql" files
+// and keeps the state in a compatible schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey identifies the advisory lock held while migrating, so replicas started together
+// apply migrations one at a time.
+const lockKey = 7234623490125
+
+var (
+	ErrDirty       = errors.New("database is dirty, fix it and force a version")
+	ErrNoChange    = errors.New("no change")
+	ErrNoMigration = errors.New("migration not found")
+)
+
+var fileRegexp = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	table      string
+}
+
+func New(db *sql.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := readMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations, table: "schema_migrations"}, nil
+}
+
+func readMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		applied := 0
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			log.Printf("migrate: applying %d_%s", migration.Version, migration.Name)
+			if err := m.run(ctx, conn, migration.Version, migration.up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+
+		if applied == 0 {
+			return ErrNoChange
+		}
+		return nil
+	})
+}
+
+// Down reverts the given number of applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+
+			previous := int64(0)
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			log.Printf("migrate: reverting %d_%s", migration.Version, migration.Name)
+			if err := m.run(ctx, conn, previous, migration.down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			version = previous
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Force sets the version without running migrations and clears the dirty flag.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if version != 0 && !m.exists(version) {
+			return ErrNoMigration
+		}
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// Status returns every known migration and whether it is applied, along with the current version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, int64, bool, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer conn.Close()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, 0, false, err
+	}
+
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: migration.Version <= version,
+		})
+	}
+
+	return statuses, version, dirty, nil
+}
+
+// run marks the target version dirty, executes the script and marks it clean,
+// so a failed migration is visible until somebody forces a version.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, version int64, script string) error {
+	if err := m.setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	return m.setVersion(ctx, conn, version, false)
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			log.Println("migrate: failed to release lock: ", err.Error())
+		}
+	}()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)", m.table))
+	return err
+}
+
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT version, dirty FROM %s LIMIT 1", m.table)).
+		Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+func (m *Migrator) setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", m.table)); err != nil {
+		return err
+	}
+
+	if version != 0 || dirty {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES ($1, $2)", m.table),
+			version, dirty); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) exists(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -1,24 +1,60 @@
 package hash
 
-import (
-	"crypto/sha1"
-	"fmt"
-)
+import "errors"
 
-type SHA1Hasher struct {
-	salt string
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Algorithm is a single password hashing scheme that produces self-describing encoded hashes.
+type Algorithm interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Identify reports whether the encoded hash was produced by this algorithm.
+	Identify(encoded string) bool
+	// NeedsRehash reports whether the encoded hash was produced with outdated parameters.
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with the current algorithm and verifies
+// hashes produced by any of the known ones, so stored hashes can be upgraded on sign-in.
+type PasswordHasher struct {
+	current Algorithm
+	known   []Algorithm
 }
 
-func NewSHA1Hasher(salt string) *SHA1Hasher {
-	return &SHA1Hasher{salt: salt}
+func NewPasswordHasher(current Algorithm, legacy ...Algorithm) *PasswordHasher {
+	return &PasswordHasher{
+		current: current,
+		known:   append([]Algorithm{current}, legacy...),
+	}
 }
 
-func (h *SHA1Hasher) Hash(password string) (string, error) {
-	hash := sha1.New()
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	algorithm, err := h.identify(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	return algorithm.Verify(password, encoded)
+}
+
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	if !h.current.Identify(encoded) {
+		return true
+	}
+
+	return h.current.NeedsRehash(encoded)
+}
 
-	if _, err := hash.Write([]byte(password)); err != nil {
-		return "", err
+func (h *PasswordHasher) identify(encoded string) (Algorithm, error) {
+	for _, algorithm := range h.known {
+		if algorithm.Identify(encoded) {
+			return algorithm, nil
+		}
 	}
 
-	return fmt.Sprintf("%x", hash.Sum([]byte(h.salt))), nil
+	return nil, ErrUnknownHashFormat
 }
@@ -0,0 +1,183 @@
+package hash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	h := NewArgon2idHasher(testArgon2idParams)
+
+	encoded, err := h.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") || !h.Identify(encoded) {
+		t.Fatalf("unexpected encoding %s", encoded)
+	}
+
+	if ok, err := h.Verify("secret123", encoded); !ok || err != nil {
+		t.Errorf("Verify with the password = %t, %v", ok, err)
+	}
+	if ok, err := h.Verify("secret124", encoded); ok || err != nil {
+		t.Errorf("Verify with a wrong password = %t, %v", ok, err)
+	}
+
+	if h.NeedsRehash(encoded) {
+		t.Error("hash with the current params needs a rehash")
+	}
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	if !NewArgon2idHasher(stronger).NeedsRehash(encoded) {
+		t.Error("hash with fewer iterations doesn't need a rehash")
+	}
+}
+
+func TestArgon2idHasherParsesPHCStrings(t *testing.T) {
+	h := NewArgon2idHasher(testArgon2idParams)
+	encoded, err := h.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(encoded, "$")
+
+	// hashes made with other params are verified with the params they were made with
+	other := testArgon2idParams
+	other.Memory, other.KeyLength = 2048, 16
+	otherEncoded, err := NewArgon2idHasher(other).Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := h.Verify("secret123", otherEncoded); !ok || err != nil {
+		t.Errorf("Verify of a hash with other params = %t, %v", ok, err)
+	}
+
+	for name, malformed := range map[string]string{
+		"argon2i":        strings.Replace(encoded, "$argon2id$", "$argon2i$", 1),
+		"missing part":   strings.Join(parts[:5], "$"),
+		"old version":    strings.Replace(encoded, "$v=19$", "$v=16$", 1),
+		"bad version":    strings.Replace(encoded, "$v=19$", "$v=x$", 1),
+		"bad params":     strings.Replace(encoded, "m=1024,t=1,p=1", "m=1024,t=one,p=1", 1),
+		"bad salt":       strings.Join([]string{"", parts[1], parts[2], parts[3], "!!", parts[5]}, "$"),
+		"bad hash":       strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "!!"}, "$"),
+		"bcrypt instead": "$2a$10$abcdefghijklmnopqrstuuK0m7hxzVHaEcDoRrQHk1B3tUtW8yA1.",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if ok, err := h.Verify("secret123", malformed); ok || err == nil {
+				t.Errorf("Verify = %t, %v, want an error", ok, err)
+			}
+			if !h.NeedsRehash(malformed) {
+				t.Error("malformed hash doesn't need a rehash")
+			}
+		})
+	}
+}
+
+func TestBcryptHasher(t *testing.T) {
+	h := NewBcryptHasher(bcrypt.MinCost)
+
+	encoded, err := h.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Identify(encoded) {
+		t.Errorf("%s isn't identified as bcrypt", encoded)
+	}
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if !h.Identify(prefix + encoded[4:]) {
+			t.Errorf("%s hashes aren't identified as bcrypt", prefix)
+		}
+	}
+
+	if ok, err := h.Verify("secret123", encoded); !ok || err != nil {
+		t.Errorf("Verify with the password = %t, %v", ok, err)
+	}
+	if ok, err := h.Verify("secret124", encoded); ok || err != nil {
+		t.Errorf("Verify with a wrong password = %t, %v", ok, err)
+	}
+
+	if h.NeedsRehash(encoded) {
+		t.Error("hash with the current cost needs a rehash")
+	}
+	if !NewBcryptHasher(bcrypt.MinCost + 1).NeedsRehash(encoded) {
+		t.Error("hash with a lower cost doesn't need a rehash")
+	}
+}
+
+func TestSHA1Hasher(t *testing.T) {
+	h := NewSHA1Hasher("salt")
+
+	// hex("salt") followed by sha1("password")
+	const encoded = "73616c74" + "5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8"
+
+	if got, err := h.Hash("password"); got != encoded || err != nil {
+		t.Errorf("Hash = %s, %v, want %s", got, err, encoded)
+	}
+	if ok, err := h.Verify("password", encoded); !ok || err != nil {
+		t.Errorf("Verify with the password = %t, %v", ok, err)
+	}
+	if ok, _ := h.Verify("passwort", encoded); ok {
+		t.Error("Verify with a wrong password succeeded")
+	}
+
+	if !h.Identify(encoded) || !h.NeedsRehash(encoded) {
+		t.Error("legacy hash should be identified and need a rehash")
+	}
+	for _, other := range []string{encoded[:len(encoded)-2], strings.ToUpper(encoded[:len(encoded)-1]) + "g", "$" + encoded[1:]} {
+		if h.Identify(other) {
+			t.Errorf("%s is identified as SHA-1", other)
+		}
+	}
+}
+
+func TestPasswordHasherUpgradesLegacyHashes(t *testing.T) {
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost)
+	sha1Hasher := NewSHA1Hasher("salt")
+	h := NewPasswordHasher(NewArgon2idHasher(testArgon2idParams), bcryptHasher, sha1Hasher)
+
+	current, err := h.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1Hash, err := sha1Hasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		encoded     string
+		needsRehash bool
+	}{
+		{"argon2id", current, false},
+		{"bcrypt", bcryptHash, true},
+		{"sha1", sha1Hash, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, err := h.Verify("password", tt.encoded); !ok || err != nil {
+				t.Errorf("Verify = %t, %v", ok, err)
+			}
+			if ok, _ := h.Verify("wrong", tt.encoded); ok {
+				t.Error("Verify with a wrong password succeeded")
+			}
+			if got := h.NeedsRehash(tt.encoded); got != tt.needsRehash {
+				t.Errorf("NeedsRehash = %t, want %t", got, tt.needsRehash)
+			}
+		})
+	}
+
+	if _, err := h.Verify("password", "plain text"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("Verify of an unknown format = %v, want ErrUnknownHashFormat", err)
+	}
+}
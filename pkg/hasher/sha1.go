@@ -0,0 +1,51 @@
+package hash
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// SHA1Hasher is the legacy scheme: hex(salt || sha1(password)) with a single global salt.
+// It is kept only to verify and upgrade existing hashes and must not be used as the current algorithm.
+type SHA1Hasher struct {
+	salt string
+}
+
+func NewSHA1Hasher(salt string) *SHA1Hasher {
+	return &SHA1Hasher{salt: salt}
+}
+
+func (h *SHA1Hasher) Hash(password string) (string, error) {
+	hash := sha1.New()
+
+	if _, err := hash.Write([]byte(password)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum([]byte(h.salt))), nil
+}
+
+func (h *SHA1Hasher) Verify(password, encoded string) (bool, error) {
+	expected, err := h.Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(encoded)) == 1, nil
+}
+
+func (h *SHA1Hasher) Identify(encoded string) bool {
+	if strings.HasPrefix(encoded, "$") || len(encoded) != 2*(len(h.salt)+sha1.Size) {
+		return false
+	}
+
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (h *SHA1Hasher) NeedsRehash(encoded string) bool {
+	return true
+}
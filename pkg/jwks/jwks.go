@@ -0,0 +1,272 @@
+// Package jwks verifies JWTs against a JSON Web Key Set fetched over HTTP.
+// Keys are cached by "kid" and the set is refetched periodically and whenever a token
+// is signed with a key the cache doesn't know, so signing key rotation needs no restart.
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownKey = errors.New("token is signed with an unknown key")
+	// ErrKeySetUnavailable means the key set couldn't be fetched and no key is cached,
+	// so the token could be valid but can't be checked.
+	ErrKeySetUnavailable = errors.New("key set is unavailable")
+)
+
+// minRefetchInterval limits how often unknown kids, or a key set that can't be fetched, trigger a fetch.
+const minRefetchInterval = 30 * time.Second
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type Verifier struct {
+	url             string
+	refreshInterval time.Duration
+	issuer          string
+	audience        string
+	client          *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]any
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch, successful or not, and lastErr its error
+	attemptedAt time.Time
+	lastErr     error
+
+	// fetchMu lets only one request refetch the key set, the others reuse its result.
+	fetchMu sync.Mutex
+}
+
+// NewVerifier accepts tokens whose "iss" is issuer. The "aud" claim must contain audience
+// unless audience is empty.
+func NewVerifier(url string, refreshInterval time.Duration, issuer string, audience string) *Verifier {
+	return &Verifier{
+		url:             url,
+		refreshInterval: refreshInterval,
+		issuer:          issuer,
+		audience:        audience,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		keys:            make(map[string]any),
+	}
+}
+
+// Verify checks the signature and the exp/nbf/iat/iss/aud claims and returns the token claims.
+// Tokens signed with a kid missing from the key set fail with ErrUnknownKey, and with
+// ErrKeySetUnavailable when the key set can't be fetched.
+func (v *Verifier) Verify(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) &&
+			(errors.Is(validationErr.Inner, ErrUnknownKey) || errors.Is(validationErr.Inner, ErrKeySetUnavailable)) {
+			return nil, validationErr.Inner
+		}
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(v.issuer, true) {
+		return nil, errors.New("token is issued by someone else")
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return nil, errors.New("token is meant for someone else")
+	}
+
+	return claims, nil
+}
+
+// Subject returns the "sub" claim of a verified token.
+func (v *Verifier) Subject(ctx context.Context, token string) (string, error) {
+	claims, err := v.Verify(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", errors.New("token has no subject")
+	}
+
+	return sub, nil
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (any, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > v.refreshInterval
+	canRefetch := time.Since(v.attemptedAt) > minRefetchInterval
+	err := v.lastErr
+	v.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if canRefetch {
+		err = v.refresh(ctx)
+	}
+	if err != nil {
+		if ok {
+			// keep serving the cached key while the key set is unreachable
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrKeySetUnavailable, err.Error())
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh fetches the key set at most once per minRefetchInterval, whether the fetch succeeds or not,
+// so neither an unreachable key set nor tokens with made up kids make every request wait for a fetch.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	v.mu.Lock()
+	if time.Since(v.attemptedAt) < minRefetchInterval {
+		err := v.lastErr
+		v.mu.Unlock()
+		return err
+	}
+	v.attemptedAt = time.Now()
+	v.mu.Unlock()
+
+	// a client that gives up must not count as a failed fetch
+	keys, err := v.fetch(context.WithoutCancel(ctx))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.lastErr = err
+	if err == nil {
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+
+	return err
+}
+
+func (v *Verifier) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch key set: %s", resp.Status)
+	}
+
+	var set keySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseKey(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func parseKey(jwk jsonWebKey) (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
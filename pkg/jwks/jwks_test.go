@@ -0,0 +1,46 @@
+package jwks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifierBacksOffWhileKeySetIsUnavailable(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewVerifier(server.URL, time.Hour, "issuer", "")
+	for _, kid := range []string{"a", "b", "c", "a"} {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1", "iss": "issuer"})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := verifier.Verify(context.Background(), signed); !errors.Is(err, ErrKeySetUnavailable) {
+			t.Errorf("Verify = %v, want ErrKeySetUnavailable", err)
+		}
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want once", n)
+	}
+}
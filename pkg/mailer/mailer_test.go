@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailerGivesUpWithTheContext(t *testing.T) {
+	// a server that accepts connections and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	mailer := NewSMTPMailer(host, port, "", "", "noreply@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- mailer.Send(ctx, "someone@example.com", "subject", "body") }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error from a server that never answers")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send didn't return after the context expired")
+	}
+}
@@ -0,0 +1,227 @@
+// Package oidc signs users in with an OpenID Connect provider using the authorization code flow with PKCE.
+// Provider endpoints are discovered from the issuer and ID tokens are verified with the provider's key set.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankru/Commissions_simple/pkg/jwks"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keySetRefreshInterval = 15 * time.Minute
+
+type Config struct {
+	// Issuer is the provider's issuer identifier, its discovery document lives at Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this service's callback registered at the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// Claims are the ID token claims used to find or create the account.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	// the discovery document is fetched on first use, so an unreachable provider doesn't stop the service
+	mu       sync.Mutex
+	meta     *discovery
+	verifier *jwks.Verifier
+}
+
+func NewProvider(config Config) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, *jwks.Verifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, p.verifier, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch discovery document: %s", resp.Status)
+	}
+
+	var meta discovery
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, nil, err
+	}
+
+	if meta.Issuer != p.config.Issuer {
+		return nil, nil, fmt.Errorf("discovery document is for issuer %s, expected %s", meta.Issuer, p.config.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, nil, errors.New("discovery document misses required endpoints")
+	}
+
+	p.meta = &meta
+	p.verifier = jwks.NewVerifier(meta.JWKSURI, keySetRefreshInterval, meta.Issuer, p.config.ClientID)
+
+	return p.meta, p.verifier, nil
+}
+
+// AuthCodeURL returns the provider page the user is redirected to. codeVerifier is kept by the caller
+// and passed to Exchange, the provider only sees its S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+
+	return authURL.String(), nil
+}
+
+func codeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Exchange redeems the authorization code and returns the claims of the verified ID token.
+// The token must be issued by the provider for this client and carry the nonce of the login.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	meta, verifier, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token request failed: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return Claims{}, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, verifier, tokenResp.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, verifier *jwks.Verifier, idToken, nonce string) (Claims, error) {
+	claims, err := verifier.Verify(ctx, idToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	// the verifier has checked iss and aud
+	if azp, ok := claims["azp"].(string); ok && azp != p.config.ClientID {
+		return Claims{}, errors.New("id token is issued for another client")
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return Claims{}, errors.New("id token nonce doesn't match")
+	}
+
+	result := Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	// some providers send the flag as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+
+	if result.Subject == "" {
+		return Claims{}, errors.New("id token has no subject")
+	}
+
+	return result, nil
+}
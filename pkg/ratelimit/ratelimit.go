@@ -0,0 +1,81 @@
+// Package ratelimit implements token bucket rate limiting. Buckets live in a Store, either in memory
+// for a single instance or in Redis when several replicas have to share them.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit refills Requests tokens every Per, a bucket holds at most Burst of them.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result describes the bucket after a request took, or failed to take, a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket is full again
+	Reset time.Duration
+	// RetryAfter is when the next token is available, zero when the request is allowed
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	// Take removes a token from the bucket of the key, tokens is what is left in it.
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, tokens float64, err error)
+}
+
+type Limiter struct {
+	store    Store
+	policies map[string]Limit
+	fallback Limit
+}
+
+// NewLimiter applies policies by name, names without a policy get the fallback limit.
+func NewLimiter(store Store, policies map[string]Limit, fallback Limit) *Limiter {
+	return &Limiter{
+		store:    store,
+		policies: policies,
+		fallback: fallback,
+	}
+}
+
+func (l *Limiter) Allow(ctx context.Context, policy string, key string) (Result, error) {
+	limit, ok := l.policies[policy]
+	if !ok {
+		limit = l.fallback
+	}
+
+	allowed, tokens, err := l.store.Take(ctx, policy+":"+key, limit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rate := limit.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	return result, nil
+}
+
+// refill returns the tokens in a bucket that had tokens elapsed time ago.
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	return math.Min(float64(limit.Burst), tokens+math.Max(0, elapsed.Seconds())*limit.rate())
+}
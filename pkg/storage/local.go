@@ -0,0 +1,102 @@
+// Package storage keeps uploaded files on the local filesystem or in an S3-compatible service.
+// Files are addressed by slash-separated keys.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound            = errors.New("file not found")
+	ErrPresignNotSupported = errors.New("storage can't generate presigned URLs")
+)
+
+// Local stores files under a directory of the local filesystem.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("invalid file key " + key)
+	}
+	return filepath.Join(l.dir, clean), nil
+}
+
+// Put writes r to the file under key and returns the number of bytes written. The file appears
+// only once it is complete, a failed write leaves nothing behind. The content type isn't kept.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the file under key. Deleting a missing file is not an error.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet always fails, local files are only served through the API.
+func (l *Local) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,419 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartSize is the size of the parts of multipart uploads, the smallest S3 accepts.
+// Smaller files are sent in a single request.
+const PartSize = 5 << 20
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	maxPresignTTL   = 7 * 24 * time.Hour
+)
+
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as Endpoint/Bucket/key instead of Bucket.Endpoint/key, which MinIO and most stand-ins need
+	PathStyle bool
+}
+
+// S3 stores files in a bucket of an S3-compatible service. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %s", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = u.Path + "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = encodeQuery(query)
+	return &u
+}
+
+// Put streams r to the object under key. Files up to PartSize are sent in one request,
+// larger ones as a multipart upload, so at most one part is held in memory.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error) {
+	part := make([]byte, PartSize)
+	n, err := io.ReadFull(r, part)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	if n < PartSize {
+		return int64(n), s.putObject(ctx, key, part[:n], contentType)
+	}
+
+	return s.putMultipart(ctx, key, part, r, contentType)
+}
+
+func (s *S3) putObject(ctx context.Context, key string, body []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) putMultipart(ctx context.Context, key string, first []byte, r io.Reader, contentType string) (int64, error) {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return 0, err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeXML(resp, &initiated)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := s.uploadParts(ctx, key, initiated.UploadID, first, r)
+	if err != nil {
+		// a failed abort only leaves parts behind until the bucket's lifecycle rules clean them up
+		if resp, abortErr := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return size, err
+	}
+
+	return size, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3) uploadParts(ctx context.Context, key, uploadId string, part []byte, r io.Reader) (int64, error) {
+	var size int64
+	parts := make([]completedPart, 0)
+
+	for number := 1; len(part) > 0; number++ {
+		resp, err := s.do(ctx, http.MethodPut, key, url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadId},
+		}, nil, part)
+		if err != nil {
+			return size, err
+		}
+		resp.Body.Close()
+
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		size += int64(len(part))
+
+		buf := part[:cap(part)]
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return size, err
+		}
+		part = buf[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return size, err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}}, nil, body)
+	if err != nil {
+		return size, err
+	}
+
+	// the completion can fail after the 200 status is sent, the error is then in the body
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := decodeXML(resp, &result); err != nil {
+		return size, err
+	}
+	if result.XMLName.Local == "Error" {
+		return size, fmt.Errorf("failed to complete upload: %s %s", result.Code, result.Message)
+	}
+
+	return size, nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object under key. Deleting a missing object is not an error.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignGet returns a URL anyone can download the object from until it expires, at most in a week.
+func (s *S3) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > maxPresignTTL {
+		return "", fmt.Errorf("presigned URL lifetime must be between 1s and %s", maxPresignTTL)
+	}
+
+	now := s.now().UTC()
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.config.AccessKey + "/" + s.credentialScope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u := s.objectURL(key, query)
+
+	header := http.Header{}
+	header.Set("Host", u.Host)
+	signature, _ := s.signature(now, http.MethodGet, u, header, unsignedPayload)
+
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// do sends a signed request and turns error statuses into errors. Bodies are small enough
+// to be hashed, larger uploads are split into parts.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key, query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+		return nil, fmt.Errorf("s3 %s %s: %s %s %s", method, key, resp.Status, apiErr.Code, apiErr.Message)
+	}
+
+	return resp, nil
+}
+
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signature, signedHeaders := s.signature(now, req.Method, req.URL, req.Header, payloadHash)
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, s.credentialScope(now), signedHeaders, signature))
+	// the Host header is sent from req.Host, not from the header map
+	req.Header.Del("Host")
+}
+
+func (s *S3) credentialScope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature computes the AWS Signature Version 4 of the request over its Host and X-Amz-* headers,
+// for requests signed in the Authorization header or in the query. It also returns the signed header names.
+func (s *S3) signature(t time.Time, method string, u *url.URL, header http.Header, payloadHash string) (string, string) {
+	names := make([]string, 0, len(header))
+	values := make(map[string]string, len(header))
+	for name, v := range header {
+		lower := strings.ToLower(name)
+		if lower != "host" && !strings.HasPrefix(lower, "x-amz-") {
+			continue
+		}
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(u.RawQuery),
+		canonicalHeaders.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateFormat),
+		s.credentialScope(t),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign)), strings.Join(names, ";")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encodePath escapes every byte of the path but the unreserved characters and slashes, as SigV4 expects.
+func encodePath(path string) string {
+	var b strings.Builder
+	for _, segment := range strings.SplitAfter(path, "/") {
+		trimmed := strings.TrimSuffix(segment, "/")
+		b.WriteString(uriEncode(trimmed))
+		if len(trimmed) < len(segment) {
+			b.WriteString("/")
+		}
+	}
+	return b.String()
+}
+
+func encodeQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	return canonicalQuery(strings.Join(pairs, "&"))
+}
+
+// canonicalQuery sorts the already encoded query parameters by name, then by value.
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	sort.Slice(pairs, func(i, j int) bool {
+		nameI, valueI, _ := strings.Cut(pairs[i], "=")
+		nameJ, valueJ, _ := strings.Cut(pairs[j], "=")
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		return valueI < valueJ
+	})
+	for i, pair := range pairs {
+		if !strings.Contains(pair, "=") {
+			pairs[i] = pair + "="
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func decodeXML(resp *http.Response, dst any) error {
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(dst)
+}
@@ -1,3 +1,7 @@
+DROP TABLE IF EXISTS drawings.drawings_tags;
+DROP TABLE IF EXISTS drawings.tags;
+DROP TABLE IF EXISTS drawings.drawings;
+DROP SCHEMA IF EXISTS drawings;
 DROP TABLE IF EXISTS users.user_reviews;
-DROP TABLE IF EXISTS users.accounts;
-DROP SCHEMA IF EXISTS users;
\ No newline at end of file
+DROP TABLE IF EXISTS users.users;
+DROP SCHEMA IF EXISTS users;
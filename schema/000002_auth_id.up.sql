@@ -0,0 +1,2 @@
+-- The external auth service identifies users by a numeric id, so every user gets a stable numeric alias.
+ALTER TABLE users.users ADD COLUMN IF NOT EXISTS auth_id BIGSERIAL UNIQUE;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users.refresh_tokens (
+                                id BIGSERIAL PRIMARY KEY,
+                                user_id UUID NOT NULL REFERENCES users.users(user_id) ON DELETE CASCADE,
+                                token TEXT UNIQUE NOT NULL,
+                                expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON users.refresh_tokens(user_id);
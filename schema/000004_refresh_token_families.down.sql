@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS users.idx_refresh_tokens_family;
+
+ALTER TABLE users.refresh_tokens
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS revoked_at;
+
+ALTER TABLE users.refresh_tokens RENAME COLUMN token_hash TO token;
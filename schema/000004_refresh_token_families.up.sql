@@ -0,0 +1,12 @@
+-- Refresh tokens are now stored hashed and grouped into families; plain tokens from before are unusable.
+DELETE FROM users.refresh_tokens;
+
+ALTER TABLE users.refresh_tokens RENAME COLUMN token TO token_hash;
+
+ALTER TABLE users.refresh_tokens
+    ADD COLUMN IF NOT EXISTS family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON users.refresh_tokens(family_id);
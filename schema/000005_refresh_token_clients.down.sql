@@ -0,0 +1,3 @@
+ALTER TABLE users.refresh_tokens
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip;
@@ -0,0 +1,3 @@
+ALTER TABLE users.refresh_tokens
+    ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE users.users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users.users ADD CONSTRAINT users_role_check CHECK (role IN ('buyer', 'artist', 'both', 'admin'));
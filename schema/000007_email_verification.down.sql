@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS users.action_tokens;
+ALTER TABLE users.users DROP COLUMN IF EXISTS email_verified_at;
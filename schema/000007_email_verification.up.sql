@@ -0,0 +1,16 @@
+ALTER TABLE users.users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+-- accounts created before verification existed are trusted
+UPDATE users.users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+-- single-use tokens sent to users by email, e.g. for verification or password reset
+CREATE TABLE IF NOT EXISTS users.action_tokens (
+                                token_hash TEXT PRIMARY KEY,
+                                user_id UUID NOT NULL REFERENCES users.users(user_id) ON DELETE CASCADE,
+                                purpose TEXT NOT NULL,
+                                expires_at TIMESTAMP NOT NULL,
+                                used_at TIMESTAMP,
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_action_tokens_user ON users.action_tokens(user_id, purpose);
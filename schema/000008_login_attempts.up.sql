@@ -0,0 +1,9 @@
+-- failed sign-in attempts per account (scope 'account', key = email) and per client (scope 'ip')
+CREATE TABLE IF NOT EXISTS users.login_attempts (
+                                scope TEXT NOT NULL,
+                                key TEXT NOT NULL,
+                                failures INT NOT NULL DEFAULT 0,
+                                last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                locked_until TIMESTAMP,
+                                PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,15 @@
+ALTER TABLE users.users
+    ADD COLUMN IF NOT EXISTS totp_secret TEXT,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP,
+    -- the last accepted time step, a code can't be used twice
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS users.recovery_codes (
+                                id BIGSERIAL PRIMARY KEY,
+                                user_id UUID NOT NULL REFERENCES users.users(user_id) ON DELETE CASCADE,
+                                code_hash TEXT NOT NULL,
+                                used_at TIMESTAMP,
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON users.recovery_codes(user_id);
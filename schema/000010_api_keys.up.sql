@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS users.api_keys (
+                                key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                user_id UUID NOT NULL REFERENCES users.users(user_id) ON DELETE CASCADE,
+                                name VARCHAR(100) NOT NULL,
+                                -- public part of the key, used to find it without scanning hashes
+                                prefix TEXT UNIQUE NOT NULL,
+                                key_hash TEXT NOT NULL,
+                                scopes TEXT[] NOT NULL,
+                                expires_at TIMESTAMP,
+                                last_used_at TIMESTAMP,
+                                revoked_at TIMESTAMP,
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON users.api_keys(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS users.oidc_states;
+DROP TABLE IF EXISTS users.external_identities;
@@ -0,0 +1,22 @@
+-- accounts at OpenID Connect providers linked to users
+CREATE TABLE IF NOT EXISTS users.external_identities (
+                                provider TEXT NOT NULL,
+                                subject TEXT NOT NULL,
+                                user_id UUID NOT NULL REFERENCES users.users(user_id) ON DELETE CASCADE,
+                                email VARCHAR(255),
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                last_login_at TIMESTAMP,
+                                PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_identities_user ON users.external_identities(user_id);
+
+-- logins started at a provider and not finished yet
+CREATE TABLE IF NOT EXISTS users.oidc_states (
+                                state_hash TEXT PRIMARY KEY,
+                                provider TEXT NOT NULL,
+                                nonce TEXT NOT NULL,
+                                code_verifier TEXT NOT NULL,
+                                expires_at TIMESTAMP NOT NULL,
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS users.audit_events;
+DROP FUNCTION IF EXISTS users.audit_events_append_only();
@@ -0,0 +1,28 @@
+-- no foreign keys: events must outlive the users they mention
+CREATE TABLE IF NOT EXISTS users.audit_events (
+                                event_id BIGSERIAL PRIMARY KEY,
+                                actor_id UUID,
+                                target_id UUID,
+                                action TEXT NOT NULL,
+                                ip TEXT,
+                                user_agent TEXT,
+                                outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+                                metadata JSONB NOT NULL DEFAULT '{}',
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON users.audit_events(actor_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON users.audit_events(target_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON users.audit_events(action, event_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created ON users.audit_events(created_at);
+
+-- the log is append-only
+CREATE OR REPLACE FUNCTION users.audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON users.audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION users.audit_events_append_only();
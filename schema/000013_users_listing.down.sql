@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users.idx_users_username_prefix;
+DROP INDEX IF EXISTS users.idx_users_username_id;
+DROP INDEX IF EXISTS users.idx_users_created;
+
+ALTER TABLE users.users ALTER COLUMN created_at DROP NOT NULL;
@@ -0,0 +1,6 @@
+UPDATE users.users SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE users.users ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_created ON users.users(created_at, user_id);
+CREATE INDEX IF NOT EXISTS idx_users_username_id ON users.users(username, user_id);
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users.users(lower(username) text_pattern_ops);
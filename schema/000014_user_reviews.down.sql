@@ -0,0 +1,14 @@
+ALTER TABLE users.user_reviews
+    DROP CONSTRAINT IF EXISTS user_reviews_not_self,
+    DROP CONSTRAINT IF EXISTS user_reviews_reviewer_reviewee_key,
+    DROP COLUMN IF EXISTS updated_at,
+    ALTER COLUMN created_at DROP NOT NULL;
+
+-- bring back the reviews the up migration removed, unless their users are gone
+INSERT INTO users.user_reviews (review_id, reviewer_id, reviewee_id, rating, comment, created_at)
+SELECT rr.review_id, rr.reviewer_id, rr.reviewee_id, rr.rating, rr.comment, rr.created_at
+FROM users.user_reviews_removed rr
+WHERE EXISTS (SELECT 1 FROM users.users u WHERE u.user_id = rr.reviewer_id)
+  AND EXISTS (SELECT 1 FROM users.users u WHERE u.user_id = rr.reviewee_id)
+ON CONFLICT (review_id) DO NOTHING;
+DROP TABLE IF EXISTS users.user_reviews_removed;
@@ -0,0 +1,29 @@
+-- keep the latest review of each reviewer for each user and drop self-reviews before adding the constraints.
+-- The removed rows are moved to users.user_reviews_removed, nothing is lost; drop that table once they are checked.
+CREATE TABLE IF NOT EXISTS users.user_reviews_removed (
+    LIKE users.user_reviews,
+    reason TEXT NOT NULL CHECK (reason IN ('duplicate', 'self_review')),
+    removed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+WITH removed AS (
+    DELETE FROM users.user_reviews r
+        USING users.user_reviews newer
+        WHERE r.reviewer_id = newer.reviewer_id AND r.reviewee_id = newer.reviewee_id AND r.review_id < newer.review_id
+        RETURNING r.*
+)
+INSERT INTO users.user_reviews_removed (review_id, reviewer_id, reviewee_id, rating, comment, created_at, reason)
+SELECT review_id, reviewer_id, reviewee_id, rating, comment, created_at, 'duplicate' FROM removed;
+
+WITH removed AS (
+    DELETE FROM users.user_reviews WHERE reviewer_id = reviewee_id RETURNING *
+)
+INSERT INTO users.user_reviews_removed (review_id, reviewer_id, reviewee_id, rating, comment, created_at, reason)
+SELECT review_id, reviewer_id, reviewee_id, rating, comment, created_at, 'self_review' FROM removed;
+
+UPDATE users.user_reviews SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE users.user_reviews
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD CONSTRAINT user_reviews_reviewer_reviewee_key UNIQUE (reviewer_id, reviewee_id),
+    ADD CONSTRAINT user_reviews_not_self CHECK (reviewer_id <> reviewee_id);
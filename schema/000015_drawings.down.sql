@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS drawings.idx_drawings_created;
+DROP INDEX IF EXISTS drawings.idx_drawings_artist_created;
+
+ALTER TABLE drawings.drawings
+    DROP COLUMN IF EXISTS size_bytes,
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS title,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
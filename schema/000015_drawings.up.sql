@@ -0,0 +1,13 @@
+UPDATE drawings.drawings SET created_at = NOW() WHERE created_at IS NULL;
+UPDATE drawings.drawings SET updated_at = created_at WHERE updated_at IS NULL;
+
+ALTER TABLE drawings.drawings
+    ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description TEXT,
+    ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0,
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_drawings_artist_created ON drawings.drawings(artist_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_drawings_created ON drawings.drawings(created_at DESC);
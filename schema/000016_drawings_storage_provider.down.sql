@@ -0,0 +1 @@
+DROP INDEX IF EXISTS drawings.idx_drawings_provider;
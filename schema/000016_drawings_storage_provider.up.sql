@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_drawings_provider ON drawings.drawings(storage_provider, drawing_id);
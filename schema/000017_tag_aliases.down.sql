@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS drawings.idx_tags_name_prefix;
+DROP TABLE IF EXISTS drawings.tag_aliases;
@@ -0,0 +1,10 @@
+-- alternative names of a tag: attaching or searching by an alias uses the tag. Merged tags live on as aliases.
+CREATE TABLE IF NOT EXISTS drawings.tag_aliases (
+                                alias TEXT PRIMARY KEY,
+                                tag_id INT NOT NULL REFERENCES drawings.tags(tag_id) ON DELETE CASCADE,
+                                created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_aliases_tag ON drawings.tag_aliases(tag_id);
+CREATE INDEX IF NOT EXISTS idx_tag_aliases_prefix ON drawings.tag_aliases(alias text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON drawings.tags(tag_name text_pattern_ops);
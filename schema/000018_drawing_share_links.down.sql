@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS drawings.idx_drawings_public_created;
+
+ALTER TABLE drawings.drawings DROP COLUMN IF EXISTS share_version;
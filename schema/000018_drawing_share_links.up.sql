@@ -0,0 +1,4 @@
+-- share links are signed with the version, bumping it invalidates every link given out so far
+ALTER TABLE drawings.drawings ADD COLUMN IF NOT EXISTS share_version INT NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_drawings_public_created ON drawings.drawings(created_at DESC) WHERE visibility = 'public';
@@ -0,0 +1,7 @@
+// Package schema embeds the SQL migrations so the binary can apply them without the source tree.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS